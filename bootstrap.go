@@ -0,0 +1,204 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	defaultBootstrapAttempts   = 3
+	defaultBootstrapBackoff    = time.Second
+	defaultBootstrapMaxBackoff = 30 * time.Second
+)
+
+// ErrNotEnoughBootstrapPeers is returned by BootstrapContext when fewer than
+// BootstrapParams.MinPeers bootstrap peers could be connected.
+var ErrNotEnoughBootstrapPeers = errors.New("could not connect to enough bootstrap peers")
+
+// BootstrapParams contains the options for BootstrapContext.
+type BootstrapParams struct {
+	// MinPeers is the number of bootstrap peers that must be connected
+	// for bootstrapping to succeed. Defaults to half of the given peers
+	// (rounded up), and at least 1. A negative value means that no
+	// connected peers are required.
+	MinPeers int
+	// MaxAttempts is the number of times that connecting to the
+	// bootstrap peers is attempted before giving up. Only peers which
+	// are not connected are retried. Defaults to 3.
+	MaxAttempts int
+	// Backoff is the time to wait after the first failed attempt. It is
+	// doubled after every attempt, up to MaxBackoff. Defaults to 1
+	// second and 30 seconds respectively.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Interval, when set, starts a background task which checks, every
+	// Interval, whether the Peer is connected to fewer than MinPeers
+	// peers, in which case bootstrapping is performed again. The task
+	// stops when the Peer is closed.
+	Interval time.Duration
+}
+
+func (params *BootstrapParams) setDefaults(nPeers int) {
+	if params.MinPeers == 0 {
+		params.MinPeers = max(1, (nPeers+1)/2)
+	}
+	if params.MaxAttempts <= 0 {
+		params.MaxAttempts = defaultBootstrapAttempts
+	}
+	if params.Backoff <= 0 {
+		params.Backoff = defaultBootstrapBackoff
+	}
+	if params.MaxBackoff <= 0 {
+		params.MaxBackoff = defaultBootstrapMaxBackoff
+	}
+}
+
+// BootstrapResult reports the outcome of bootstrapping.
+type BootstrapResult struct {
+	// Connected lists the bootstrap peers that are connected.
+	Connected []peer.ID
+	// Failed contains the last connection error for every bootstrap
+	// peer that could not be connected.
+	Failed map[peer.ID]error
+}
+
+// Bootstrap is an optional helper to connect to the given peers and bootstrap
+// the Peer DHT (and Bitswap). This is a best-effort function. Errors are only
+// logged and a warning is printed when less than half of the given peers
+// could be contacted. It is fine to pass a list where some peers will not be
+// reachable. See BootstrapContext for a variant which reports results.
+func (p *Peer) Bootstrap(peers []peer.AddrInfo) {
+	minPeers := len(peers) / 2
+	if minPeers == 0 {
+		minPeers = -1 // no peers required
+	}
+	res, err := p.BootstrapContext(p.ctx, peers, &BootstrapParams{
+		MinPeers:    minPeers,
+		MaxAttempts: 1,
+	})
+	for pid, err := range res.Failed {
+		logger.Warnf("connecting to %s: %s", pid, err)
+	}
+	if errors.Is(err, ErrNotEnoughBootstrapPeers) {
+		logger.Warnf("only connected to %d bootstrap peers out of %d", len(res.Connected), len(peers))
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// BootstrapContext connects to the given peers and bootstraps the Peer DHT
+// (and Bitswap). Connecting is retried with exponential backoff until
+// params.MinPeers bootstrap peers are connected or params.MaxAttempts is
+// reached, in which case ErrNotEnoughBootstrapPeers is returned along with
+// the result. The DHT is bootstrapped in every case, as the Peer may have
+// other connections (e.g. from peering or mDNS).
+func (p *Peer) BootstrapContext(ctx context.Context, peers []peer.AddrInfo, params *BootstrapParams) (BootstrapResult, error) {
+	if p.cfg.Offline || p.host == nil {
+		return BootstrapResult{}, ErrOffline
+	}
+
+	if params == nil {
+		params = &BootstrapParams{}
+	}
+	params.setDefaults(len(peers))
+
+	res, err := p.bootstrap(ctx, peers, params)
+	if params.Interval > 0 {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.rebootstrapLoop(peers, params)
+		}()
+	}
+	return res, err
+}
+
+func (p *Peer) bootstrap(ctx context.Context, peers []peer.AddrInfo, params *BootstrapParams) (BootstrapResult, error) {
+	var res BootstrapResult
+	backoff := params.Backoff
+	for attempt := 1; ; attempt++ {
+		res = p.connectPeers(ctx, peers)
+		if len(res.Connected) >= params.MinPeers || attempt >= params.MaxAttempts {
+			break
+		}
+
+		logger.Debugf("connected to %d bootstrap peers out of %d. Retrying in %s", len(res.Connected), len(peers), backoff)
+		select {
+		case <-ctx.Done():
+			return res, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, params.MaxBackoff)
+	}
+
+	if p.dht != nil {
+		err := p.dht.Bootstrap(ctx)
+		if err != nil {
+			return res, fmt.Errorf("bootstrapping DHT: %w", err)
+		}
+	}
+	if len(res.Connected) < params.MinPeers {
+		return res, ErrNotEnoughBootstrapPeers
+	}
+	return res, nil
+}
+
+// connectPeers connects, in parallel, to the given peers unless they are
+// connected already.
+func (p *Peer) connectPeers(ctx context.Context, peers []peer.AddrInfo) BootstrapResult {
+	res := BootstrapResult{Failed: make(map[peer.ID]error)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, pinfo := range peers {
+		wg.Add(1)
+		go func(pinfo peer.AddrInfo) {
+			defer wg.Done()
+			var err error
+			if p.host.Network().Connectedness(pinfo.ID) != network.Connected {
+				err = p.host.Connect(ctx, pinfo)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Failed[pinfo.ID] = err
+				return
+			}
+			logger.Info("Connected to", pinfo.ID)
+			res.Connected = append(res.Connected, pinfo.ID)
+		}(pinfo)
+	}
+	wg.Wait()
+	return res
+}
+
+func (p *Peer) rebootstrapLoop(peers []peer.AddrInfo, params *BootstrapParams) {
+	ticker := time.NewTicker(params.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if len(p.host.Network().Peers()) >= params.MinPeers {
+			continue
+		}
+		logger.Info("connected peers below threshold. Bootstrapping again")
+		res, err := p.bootstrap(p.ctx, peers, params)
+		if err != nil && p.ctx.Err() == nil {
+			logger.Warnf("re-bootstrapping (%d peers connected): %s", len(res.Connected), err)
+		}
+	}
+}
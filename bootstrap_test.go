@@ -0,0 +1,181 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestBootstrapContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	// A peer which cannot be reached.
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachableID, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := peer.AddrInfo{
+		ID:    unreachableID,
+		Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")},
+	}
+	reachable := peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}
+	peers := []peer.AddrInfo{reachable, unreachable}
+
+	p, err := New(ctx, NewInMemoryDatastore(), nil, h1, nil, &Config{ReprovideInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.BootstrapContext(ctx, peers, &BootstrapParams{
+		MinPeers:    2,
+		MaxAttempts: 2,
+		Backoff:     10 * time.Millisecond,
+	})
+	if !errors.Is(err, ErrNotEnoughBootstrapPeers) {
+		t.Error("expected ErrNotEnoughBootstrapPeers, got:", err)
+	}
+	if len(res.Connected) != 1 || res.Connected[0] != h2.ID() {
+		t.Error("unexpected connected peers:", res.Connected)
+	}
+	if len(res.Failed) != 1 || res.Failed[unreachableID] == nil {
+		t.Error("unexpected failed peers:", res.Failed)
+	}
+
+	_, err = p.BootstrapContext(ctx, peers, &BootstrapParams{
+		MinPeers: 1,
+		Interval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The background task should reconnect to h2.
+	err = h1.Network().ClosePeer(h2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for h1.Network().Connectedness(h2.ID()) != network.Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("peer was not bootstrapped again")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	_, err = setupOfflinePeer(t).BootstrapContext(ctx, peers, nil)
+	if !errors.Is(err, ErrOffline) {
+		t.Error("expected ErrOffline")
+	}
+}
+
+func TestBootstrapSingleUnreachablePeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachableID, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []peer.AddrInfo{{
+		ID:    unreachableID,
+		Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")},
+	}}
+
+	p, err := New(ctx, NewInMemoryDatastore(), nil, h, nil, &Config{ReprovideInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	res, err := p.BootstrapContext(ctx, peers, &BootstrapParams{
+		MaxAttempts: 3,
+		Backoff:     20 * time.Millisecond,
+	})
+	if !errors.Is(err, ErrNotEnoughBootstrapPeers) {
+		t.Error("expected ErrNotEnoughBootstrapPeers, got:", err)
+	}
+	if len(res.Connected) != 0 || res.Failed[unreachableID] == nil {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	// Two backoffs between three attempts: 20ms + 40ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("connecting was not retried (took %s)", elapsed)
+	}
+
+	// Asking for no peers explicitly succeeds.
+	_, err = p.BootstrapContext(ctx, peers, &BootstrapParams{
+		MinPeers:    -1,
+		MaxAttempts: 1,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+type bootstrapCounter struct {
+	routing.Routing
+	n atomic.Int32
+}
+
+func (bc *bootstrapCounter) Bootstrap(ctx context.Context) error {
+	bc.n.Add(1)
+	return nil
+}
+
+func TestBootstrapLegacy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	bc := &bootstrapCounter{}
+	p, err := New(ctx, NewInMemoryDatastore(), nil, h, bc, &Config{ReprovideInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The DHT is bootstrapped even without bootstrap peers.
+	p.Bootstrap(nil)
+	if n := bc.n.Load(); n != 1 {
+		t.Errorf("expected the DHT to be bootstrapped once, got %d", n)
+	}
+}
@@ -0,0 +1,161 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+)
+
+var carImportBatchSize = 256
+
+// ImportCARParams contains the options for importing CAR files.
+type ImportCARParams struct {
+	// Pin pins the roots of the CAR recursively once all blocks have been
+	// imported. Blocks missing from the CAR are fetched from the network.
+	Pin bool
+	// Provide announces the roots of the CAR to the network once all
+	// blocks have been imported.
+	Provide bool
+}
+
+// ImportCAR reads a CARv1 or CARv2 file and writes all its blocks, in
+// batches, to the Peer's blockstore. The hash of every block is verified
+// against its CID before writing it. It returns the roots declared in the CAR
+// header. Roots are not required to be present in the CAR.
+func (p *Peer) ImportCAR(ctx context.Context, r io.Reader, params *ImportCARParams) ([]cid.Cid, error) {
+	if params == nil {
+		params = &ImportCARParams{}
+	}
+
+	br, err := carv2.NewBlockReader(r, carv2.WithTrustedCAR(false))
+	if err != nil {
+		return nil, err
+	}
+
+	defer p.bstore.PinLock(ctx).Unlock(ctx)
+
+	batch := make([]blocks.Block, 0, carImportBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		blk, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		batch = append(batch, blk)
+		if len(batch) == carImportBatchSize {
+			err = p.bstore.PutMany(ctx, batch)
+			if err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		err = p.bstore.PutMany(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = p.recordRoots(ctx, br.Roots...)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Pin {
+		for _, root := range br.Roots {
+			err = p.pin(ctx, root, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if params.Provide {
+		for _, root := range br.Roots {
+			err = p.reprovider.Provide(ctx, root, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		p.provideOnAdd(ctx, br.Roots...)
+	}
+	return br.Roots, nil
+}
+
+// ExportCAR writes a CARv1 file to w containing every block of the DAG
+// rooted at the given CID. Blocks are written in depth-first order, following
+// links in the order they appear in each node, so the output is
+// deterministic. Blocks that are not available locally are fetched from the
+// network using a session.
+func (p *Peer) ExportCAR(ctx context.Context, root cid.Cid, w io.Writer) error {
+	return p.exportCAR(ctx, root, w, carv2.WriteAsCarV1(true))
+}
+
+// ExportCARv2 works like ExportCAR but writes a CARv2 file, which includes
+// an index of the blocks. Since the CARv2 header can only be written once all
+// blocks are known, w must also implement io.WriterAt (i.e. an *os.File).
+func (p *Peer) ExportCARv2(ctx context.Context, root cid.Cid, w interface {
+	io.Writer
+	io.WriterAt
+}) error {
+	return p.exportCAR(ctx, root, w)
+}
+
+func (p *Peer) exportCAR(ctx context.Context, root cid.Cid, w io.Writer, opts ...carv2.Option) error {
+	car, err := carstorage.NewWritable(w, []cid.Cid{root}, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Fetch everything in parallel first, so that the depth-first walk
+	// below does not need to wait for blocks one by one.
+	err = merkledag.FetchGraph(ctx, root, p)
+	if err != nil {
+		return err
+	}
+
+	err = p.writeCARBlocks(ctx, p, car, root, cid.NewSet())
+	if err != nil {
+		return err
+	}
+	return car.Finalize()
+}
+
+func (p *Peer) writeCARBlocks(ctx context.Context, ng ipld.NodeGetter, car carstorage.WritableCar, c cid.Cid, seen *cid.Set) error {
+	if !seen.Visit(c) {
+		return nil
+	}
+
+	nd, err := ng.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	err = car.Put(ctx, c.KeyString(), nd.RawData())
+	if err != nil {
+		return err
+	}
+
+	for _, l := range nd.Links() {
+		err = p.writeCARBlocks(ctx, ng, car, l.Cid, seen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
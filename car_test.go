@@ -0,0 +1,176 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	carv2 "github.com/ipld/go-car/v2"
+)
+
+func TestExportCAR(t *testing.T) {
+	ctx := context.Background()
+	p1, p2, closer := setupPeers(t)
+	defer closer(t)
+
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"sub/b.txt": {Data: []byte("b")},
+		"sub/c.txt": {Data: []byte("a")},
+	}
+	root, err := p1.AddDirectory(ctx, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = p2.ExportCAR(ctx, root.Cid(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := carv2.NewBlockReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(br.Roots) != 1 || br.Roots[0] != root.Cid() {
+		t.Fatal("unexpected roots:", br.Roots)
+	}
+
+	// root, a.txt, sub, b.txt. c.txt has the same content as a.txt.
+	expected := []string{
+		root.Cid().String(),
+		root.Links()[0].Cid.String(),
+		root.Links()[1].Cid.String(),
+	}
+	var got []string
+	for {
+		blk, err := br.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, blk.Cid().String())
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 blocks, got %d", len(got))
+	}
+	for i, c := range expected {
+		if got[i] != c {
+			t.Errorf("block %d: expected %s, got %s", i, c, got[i])
+		}
+	}
+}
+
+func TestExportCARv2(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	root, err := p.AddFile(ctx, bytes.NewReader([]byte("hola")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fpath := filepath.Join(t.TempDir(), "export.car")
+	f, err := os.Create(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.ExportCARv2(ctx, root.Cid(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := carv2.OpenReader(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer r.Close()
+	if r.Version != 2 || !r.Header.HasIndex() {
+		t.Error("expected an indexed CARv2")
+	}
+	roots, err := r.Roots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0] != root.Cid() {
+		t.Error("unexpected roots:", roots)
+	}
+}
+
+func TestImportCAR(t *testing.T) {
+	ctx := context.Background()
+	p1 := setupOfflinePeer(t)
+	p2 := setupOfflinePeer(t)
+
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"sub/b.txt": {Data: []byte("b")},
+	}
+	root, err := p1.AddDirectory(ctx, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = p1.ExportCAR(ctx, root.Cid(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := p2.ImportCAR(ctx, &buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0] != root.Cid() {
+		t.Fatal("unexpected roots:", roots)
+	}
+
+	rsc, err := p2.GetFileByPath(ctx, "/ipfs/"+root.Cid().String()+"/sub/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(rsc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "b" {
+		t.Error("unexpected content:", string(content))
+	}
+}
+
+func TestImportCARCorrupted(t *testing.T) {
+	ctx := context.Background()
+	p1 := setupOfflinePeer(t)
+	p2 := setupOfflinePeer(t)
+
+	content := []byte("some content which will be corrupted")
+	root, err := p1.AddFile(ctx, bytes.NewReader(content), &AddParams{RawLeaves: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = p1.ExportCAR(ctx, root.Cid(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := buf.Bytes()
+	car[len(car)-1]++
+
+	_, err = p2.ImportCAR(ctx, bytes.NewReader(car), nil)
+	if err == nil {
+		t.Fatal("expected an error importing a corrupted CAR")
+	}
+	if ok, _ := p2.HasBlock(ctx, root.Cid()); ok {
+		t.Error("corrupted block should not have been imported")
+	}
+}
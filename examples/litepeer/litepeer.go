@@ -10,7 +10,6 @@ import (
 
 	ipfslite "github.com/hsanjuan/ipfs-lite"
 	"github.com/ipfs/go-cid"
-	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -19,7 +18,8 @@ func main() {
 	defer cancel()
 
 	ds := ipfslite.NewInMemoryDatastore()
-	priv, _, err := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	// Keep the same peer ID across runs.
+	priv, err := ipfslite.LoadOrCreateIdentity("litepeer.key")
 	if err != nil {
 		panic(err)
 	}
@@ -9,7 +9,6 @@ import (
 	"github.com/ipfs/go-cid"
 	format "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-log/v2"
-	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -22,7 +21,7 @@ func main() {
 	_ = log.SetLogLevel("*", "warn")
 
 	ds := ipfslite.NewInMemoryDatastore()
-	priv, _, err := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	priv, err := ipfslite.GenerateIdentity()
 	if err != nil {
 		panic(err)
 	}
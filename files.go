@@ -0,0 +1,217 @@
+package ipfslite
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	ufsio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// AddPath adds the file or directory found at the given local path to the
+// DAGService. Single files are added as with AddFile, while directories are
+// walked recursively as with AddDirectory. It returns the root ipld.Node.
+func (p *Peer) AddPath(ctx context.Context, fpath string, params *AddParams) (ipld.Node, error) {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("unrecognized file type for %s: %s", fpath, fi.Mode().Type())
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			return nil, err
+		}
+		//nolint:errcheck
+		defer f.Close()
+		return p.AddFile(ctx, f, params)
+	}
+	return p.AddDirectory(ctx, os.DirFS(fpath), params)
+}
+
+// AddDirectory adds the tree contained in the given filesystem as a UnixFS
+// directory. Every file is chunked and added following the same AddParams as
+// AddFile. Directories are HAMT-sharded when params.Shard is set or when they
+// grow too large to fit in a single block. Entries whose names start with a
+// dot are skipped unless params.Hidden is set. Symbolic links are stored as
+// UnixFS symlinks when fsys implements fs.ReadLinkFS and are followed
+// otherwise. It returns the root ipld.Node.
+func (p *Peer) AddDirectory(ctx context.Context, fsys fs.FS, params *AddParams) (ipld.Node, error) {
+	if params == nil {
+		params = &AddParams{}
+	}
+	params.setDefaults()
+
+	prefix, err := params.cidBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	defer p.bstore.PinLock(ctx).Unlock(ctx)
+	nd, err := p.addDirectory(ctx, fsys, ".", params, prefix)
+	if err != nil {
+		return nil, err
+	}
+	err = p.recordRoots(ctx, nd.Cid())
+	if err != nil {
+		return nil, err
+	}
+	p.provideOnAdd(ctx, nd.Cid())
+	return nd, nil
+}
+
+func (p *Peer) addDirectory(ctx context.Context, fsys fs.FS, dirpath string, params *AddParams, prefix cid.Builder) (ipld.Node, error) {
+	entries, err := fs.ReadDir(fsys, dirpath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := newDirectory(p.dag, params, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := entry.Name()
+		if !params.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		nd, err := p.addEntry(ctx, fsys, path.Join(dirpath, name), entry, params, prefix)
+		if err != nil {
+			return nil, err
+		}
+		err = dir.AddChild(ctx, name, nd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nd, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	err = p.dag.Add(ctx, nd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// newDirectory returns a HAMT-sharded directory when params.Shard is set.
+// Otherwise, the directory switches to a HAMT automatically when it grows
+// above ufsio.HAMTShardingSize, as Kubo does.
+func newDirectory(dserv ipld.DAGService, params *AddParams, prefix cid.Builder) (ufsio.Directory, error) {
+	if params.Shard {
+		return ufsio.NewHAMTDirectory(dserv, 0, ufsio.WithCidBuilder(prefix))
+	}
+	return ufsio.NewDirectory(dserv, ufsio.WithCidBuilder(prefix))
+}
+
+func (p *Peer) addEntry(ctx context.Context, fsys fs.FS, fpath string, entry fs.DirEntry, params *AddParams, prefix cid.Builder) (ipld.Node, error) {
+	if entry.Type()&fs.ModeSymlink != 0 {
+		if _, ok := fsys.(fs.ReadLinkFS); ok {
+			return p.addSymlink(ctx, fsys, fpath, prefix)
+		}
+		// Follow the link.
+		fi, err := fs.Stat(fsys, fpath)
+		if err != nil {
+			return nil, err
+		}
+		entry = fs.FileInfoToDirEntry(fi)
+	}
+
+	if entry.IsDir() {
+		return p.addDirectory(ctx, fsys, fpath, params, prefix)
+	}
+	// Named pipes, sockets or devices would block or never end.
+	if !entry.Type().IsRegular() {
+		return nil, fmt.Errorf("unrecognized file type for %s: %s", fpath, entry.Type())
+	}
+
+	f, err := fsys.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer f.Close()
+	return p.addFile(f, params, prefix)
+}
+
+func (p *Peer) addSymlink(ctx context.Context, fsys fs.FS, fpath string, prefix cid.Builder) (ipld.Node, error) {
+	target, err := fs.ReadLink(fsys, fpath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ft.SymlinkData(target)
+	if err != nil {
+		return nil, err
+	}
+
+	nd := merkledag.NodeWithData(data)
+	err = nd.SetCidBuilder(prefix)
+	if err != nil {
+		return nil, err
+	}
+	err = p.dag.Add(ctx, nd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// ListDirectory returns the links to the entries of the UnixFS directory
+// identified by the given CID. Both regular and HAMT-sharded directories are
+// supported.
+func (p *Peer) ListDirectory(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+	nd, err := p.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ufsio.NewDirectoryFromNode(p, nd)
+	if err != nil {
+		return nil, err
+	}
+	return dir.Links(ctx)
+}
+
+// GetToPath writes the UnixFS DAG identified by the given CID to the local
+// filesystem at fpath, which must not exist. Files, directories (including
+// HAMT-sharded ones) and symlinks are supported. All the blocks in the DAG
+// are fetched in parallel using a session before anything is written. Entry
+// names that are empty, "." or ".." or that contain path separators cause an
+// error, so that the written tree cannot escape fpath.
+func (p *Peer) GetToPath(ctx context.Context, c cid.Cid, fpath string) error {
+	err := merkledag.FetchGraph(ctx, c, p)
+	if err != nil {
+		return err
+	}
+
+	nd, err := p.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	f, err := unixfile.NewUnixfsFile(ctx, p, nd)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer f.Close()
+	return files.WriteTo(f, fpath)
+}
@@ -0,0 +1,245 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	ufsio "github.com/ipfs/boxo/ipld/unixfs/io"
+)
+
+func TestAddDirectory(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	fsys := fstest.MapFS{
+		"a.txt":        {Data: []byte("a")},
+		"sub/b.txt":    {Data: []byte("b")},
+		".hidden":      {Data: []byte("hidden")},
+		"sub/.hidden2": {Data: []byte("hidden2")},
+	}
+
+	nd, err := p.AddDirectory(ctx, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ufsio.NewDirectoryFromNode(p, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := dir.Links(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(links))
+	}
+
+	sub, err := dir.Find(ctx, "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subdir, err := ufsio.NewDirectoryFromNode(p, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := subdir.Find(ctx, "b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, err := p.GetFile(ctx, b.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(rsc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "b" {
+		t.Error("unexpected content:", string(content))
+	}
+
+	hidden, err := p.AddDirectory(ctx, fsys, &AddParams{Hidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hidden.Links()) != 3 {
+		t.Errorf("expected 3 entries with hidden files, got %d", len(hidden.Links()))
+	}
+}
+
+func TestAddPath(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	tmp := t.TempDir()
+	err := os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("a"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("a.txt", filepath.Join(tmp, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := p.AddPath(ctx, tmp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links()) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(nd.Links()))
+	}
+
+	fnd, err := p.AddPath(ctx, filepath.Join(tmp, "a.txt"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fnd.Cid() != nd.Links()[0].Cid {
+		t.Error("file added with AddPath should match the directory entry")
+	}
+}
+
+func TestAddDirectoryIrregularFile(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	fsys := fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"pipe":  {Mode: fs.ModeNamedPipe},
+	}
+	_, err := p.AddDirectory(ctx, fsys, nil)
+	if err == nil || !strings.Contains(err.Error(), "unrecognized file type") {
+		t.Error("expected an unrecognized file type error, got:", err)
+	}
+}
+
+func TestAddDirectoryShard(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	fsys := fstest.MapFS{}
+	for i := 0; i < 100; i++ {
+		fsys[fmt.Sprintf("file-%d", i)] = &fstest.MapFile{Data: []byte{byte(i)}}
+	}
+
+	nd, err := p.AddDirectory(ctx, fsys, &AddParams{Shard: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsn, err := ft.ExtractFSNode(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != ft.THAMTShard {
+		t.Fatal("expected a HAMT-sharded directory")
+	}
+
+	links, err := p.ListDirectory(ctx, nd.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != len(fsys) {
+		t.Errorf("expected %d entries, got %d", len(fsys), len(links))
+	}
+
+	nd, err = p.AddDirectory(ctx, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err = ft.ExtractFSNode(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != ft.TDirectory {
+		t.Error("small directories should not be sharded by default")
+	}
+}
+
+func TestGetToPath(t *testing.T) {
+	ctx := context.Background()
+	p1, p2, closer := setupPeers(t)
+	defer closer(t)
+
+	src := t.TempDir()
+	err := os.MkdirAll(filepath.Join(src, "sub"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("sub/a.txt", filepath.Join(src, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := p1.AddPath(ctx, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "out")
+	err = p2.GetToPath(ctx, nd.Cid(), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "sub", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "a" {
+		t.Error("unexpected content:", string(content))
+	}
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "sub/a.txt" {
+		t.Error("unexpected symlink target:", target)
+	}
+
+	err = p2.GetToPath(ctx, nd.Cid(), dst)
+	if err == nil {
+		t.Error("expected an error when the destination exists")
+	}
+}
+
+func TestGetToPathTraversal(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	fnd, err := p.AddFile(ctx, bytes.NewReader([]byte("evil")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := ft.EmptyDirNode()
+	err = dir.AddNodeLink("../evil", fnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := t.TempDir()
+	err = p.GetToPath(ctx, dir.Cid(), filepath.Join(tmp, "out"))
+	if err == nil {
+		t.Fatal("expected an error with an invalid entry name")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "evil")); !os.IsNotExist(err) {
+		t.Error("file should not have been written outside the destination")
+	}
+}
@@ -0,0 +1,277 @@
+package ipfslite
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+var _ connmgr.ConnectionGater = (*ConnectionGater)(nil)
+
+// ConnectionGater is a libp2p connection gater which restricts the peers and
+// addresses that the host connects to, based on allow and deny lists. It can
+// be passed to SetupLibp2p with the libp2p.ConnectionGater() option. Deny
+// lists always take precedence. When an allowlist is not empty, only what is
+// in it is allowed. All lists can be modified at any time, but existing
+// connections are not closed.
+//
+// Created with NewAllowlistGater, it can be used instead of a pre-shared key
+// to run private networks: unlike PSKs, which only work with TCP and
+// WebSocket, gating works with every transport, including QUIC and
+// WebTransport. Peers are identified after the security handshake, so only
+// allowed peers can open streams.
+type ConnectionGater struct {
+	mu            sync.RWMutex
+	allowlistOnly bool
+	allowed       map[peer.ID]struct{}
+	denied        map[peer.ID]struct{}
+	allowedCIDRs  map[netip.Prefix]struct{}
+	deniedCIDRs   map[netip.Prefix]struct{}
+
+	rejectedDials   atomic.Uint64
+	rejectedAccepts atomic.Uint64
+}
+
+// ConnectionGaterStats contains the number of connections rejected by a
+// ConnectionGater.
+type ConnectionGaterStats struct {
+	// RejectedDials counts the outbound connection attempts that were
+	// rejected. Dialing a peer may be rejected once per address.
+	RejectedDials uint64
+	// RejectedAccepts counts the inbound connections that were rejected.
+	RejectedAccepts uint64
+}
+
+// NewConnectionGater returns a ConnectionGater which allows every connection
+// until peers or addresses are added to its lists.
+func NewConnectionGater() *ConnectionGater {
+	return &ConnectionGater{
+		allowed:      make(map[peer.ID]struct{}),
+		denied:       make(map[peer.ID]struct{}),
+		allowedCIDRs: make(map[netip.Prefix]struct{}),
+		deniedCIDRs:  make(map[netip.Prefix]struct{}),
+	}
+}
+
+// NewAllowlistGater returns a ConnectionGater which only allows connections
+// with the given peers. Unlike with NewConnectionGater, no peer is allowed
+// when the peer allowlist is empty.
+func NewAllowlistGater(allowed ...peer.ID) *ConnectionGater {
+	g := NewConnectionGater()
+	g.allowlistOnly = true
+	g.AllowPeers(allowed...)
+	return g
+}
+
+// AllowPeers adds the given peers to the allowlist.
+func (g *ConnectionGater) AllowPeers(pids ...peer.ID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, pid := range pids {
+		g.allowed[pid] = struct{}{}
+	}
+}
+
+// RemoveAllowedPeers removes the given peers from the allowlist.
+func (g *ConnectionGater) RemoveAllowedPeers(pids ...peer.ID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, pid := range pids {
+		delete(g.allowed, pid)
+	}
+}
+
+// AllowedPeers returns the peers in the allowlist.
+func (g *ConnectionGater) AllowedPeers() []peer.ID {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return mapKeys(g.allowed)
+}
+
+// DenyPeers adds the given peers to the denylist.
+func (g *ConnectionGater) DenyPeers(pids ...peer.ID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, pid := range pids {
+		g.denied[pid] = struct{}{}
+	}
+}
+
+// RemoveDeniedPeers removes the given peers from the denylist.
+func (g *ConnectionGater) RemoveDeniedPeers(pids ...peer.ID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, pid := range pids {
+		delete(g.denied, pid)
+	}
+}
+
+// DeniedPeers returns the peers in the denylist.
+func (g *ConnectionGater) DeniedPeers() []peer.ID {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return mapKeys(g.denied)
+}
+
+// AllowCIDRs adds the given IP ranges to the address allowlist. When not
+// empty, connections to or from addresses which are not IP addresses in the
+// allowed ranges are rejected.
+func (g *ConnectionGater) AllowCIDRs(prefixes ...netip.Prefix) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, prefix := range prefixes {
+		g.allowedCIDRs[prefix.Masked()] = struct{}{}
+	}
+}
+
+// RemoveAllowedCIDRs removes the given IP ranges from the address allowlist.
+func (g *ConnectionGater) RemoveAllowedCIDRs(prefixes ...netip.Prefix) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, prefix := range prefixes {
+		delete(g.allowedCIDRs, prefix.Masked())
+	}
+}
+
+// AllowedCIDRs returns the IP ranges in the address allowlist.
+func (g *ConnectionGater) AllowedCIDRs() []netip.Prefix {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return mapKeys(g.allowedCIDRs)
+}
+
+// DenyCIDRs adds the given IP ranges to the address denylist.
+func (g *ConnectionGater) DenyCIDRs(prefixes ...netip.Prefix) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, prefix := range prefixes {
+		g.deniedCIDRs[prefix.Masked()] = struct{}{}
+	}
+}
+
+// RemoveDeniedCIDRs removes the given IP ranges from the address denylist.
+func (g *ConnectionGater) RemoveDeniedCIDRs(prefixes ...netip.Prefix) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, prefix := range prefixes {
+		delete(g.deniedCIDRs, prefix.Masked())
+	}
+}
+
+// DeniedCIDRs returns the IP ranges in the address denylist.
+func (g *ConnectionGater) DeniedCIDRs() []netip.Prefix {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return mapKeys(g.deniedCIDRs)
+}
+
+// Stats returns the number of connections rejected so far.
+func (g *ConnectionGater) Stats() ConnectionGaterStats {
+	return ConnectionGaterStats{
+		RejectedDials:   g.rejectedDials.Load(),
+		RejectedAccepts: g.rejectedAccepts.Load(),
+	}
+}
+
+// IsAllowed returns whether connections with the given peer are allowed.
+func (g *ConnectionGater) IsAllowed(pid peer.ID) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if _, ok := g.denied[pid]; ok {
+		return false
+	}
+	if len(g.allowed) == 0 {
+		return !g.allowlistOnly
+	}
+	_, ok := g.allowed[pid]
+	return ok
+}
+
+// IsAllowedAddr returns whether connections to or from the given address are
+// allowed.
+func (g *ConnectionGater) IsAllowedAddr(addr multiaddr.Multiaddr) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if len(g.allowedCIDRs) == 0 && len(g.deniedCIDRs) == 0 {
+		return true
+	}
+
+	netIP, err := manet.ToIP(addr)
+	if err != nil {
+		// Not an IP address.
+		return len(g.allowedCIDRs) == 0
+	}
+	ip, ok := netip.AddrFromSlice(netIP)
+	if !ok {
+		return len(g.allowedCIDRs) == 0
+	}
+	ip = ip.Unmap()
+
+	for prefix := range g.deniedCIDRs {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	if len(g.allowedCIDRs) == 0 {
+		return true
+	}
+	for prefix := range g.allowedCIDRs {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *ConnectionGater) reject(dir network.Direction, allow bool) bool {
+	if allow {
+		return true
+	}
+	if dir == network.DirInbound {
+		g.rejectedAccepts.Add(1)
+	} else {
+		g.rejectedDials.Add(1)
+	}
+	return false
+}
+
+// InterceptPeerDial implements connmgr.ConnectionGater.
+func (g *ConnectionGater) InterceptPeerDial(pid peer.ID) bool {
+	return g.reject(network.DirOutbound, g.IsAllowed(pid))
+}
+
+// InterceptAddrDial implements connmgr.ConnectionGater.
+func (g *ConnectionGater) InterceptAddrDial(pid peer.ID, addr multiaddr.Multiaddr) bool {
+	return g.reject(network.DirOutbound, g.IsAllowedAddr(addr))
+}
+
+// InterceptAccept implements connmgr.ConnectionGater. The remote peer is not
+// known yet when accepting, so it is checked in InterceptSecured.
+func (g *ConnectionGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return g.reject(network.DirInbound, g.IsAllowedAddr(addrs.RemoteMultiaddr()))
+}
+
+// InterceptSecured implements connmgr.ConnectionGater.
+func (g *ConnectionGater) InterceptSecured(dir network.Direction, pid peer.ID, addrs network.ConnMultiaddrs) bool {
+	return g.reject(dir, g.IsAllowed(pid))
+}
+
+// InterceptUpgraded implements connmgr.ConnectionGater.
+func (g *ConnectionGater) InterceptUpgraded(conn network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+func mapKeys[K comparable](m map[K]struct{}) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,121 @@
+package ipfslite
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func setupQUICHost(t *testing.T, opts ...libp2p.Option) host.Host {
+	t.Helper()
+	priv, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := multiaddr.StringCast("/ip4/127.0.0.1/udp/0/quic-v1")
+	h, dht, err := SetupLibp2p(priv, nil, []multiaddr.Multiaddr{listen}, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = dht.Close()
+		_ = h.Close()
+	})
+	return h
+}
+
+func TestAllowlistGaterQUIC(t *testing.T) {
+	ctx := context.Background()
+
+	gater := NewAllowlistGater()
+	h1 := setupQUICHost(t, libp2p.ConnectionGater(gater))
+	h2 := setupQUICHost(t)
+	h3 := setupQUICHost(t)
+	gater.AllowPeers(h2.ID())
+
+	err := h2.Connect(ctx, peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := h1.Network().ConnsToPeer(h2.ID())
+	if len(conns) == 0 {
+		t.Fatal("h2 should be connected")
+	}
+	if _, err := conns[0].RemoteMultiaddr().ValueForProtocol(multiaddr.P_QUIC_V1); err != nil {
+		t.Error("expected a QUIC connection:", conns[0].RemoteMultiaddr())
+	}
+
+	err = h3.Connect(ctx, peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()})
+	if err == nil && len(h1.Network().ConnsToPeer(h3.ID())) > 0 {
+		t.Error("h3 should not be able to connect")
+	}
+	err = h1.Connect(ctx, peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()})
+	if err == nil {
+		t.Error("h1 should not dial h3")
+	}
+
+	gater.AllowPeers(h3.ID())
+	err = h1.Connect(ctx, peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionGater(t *testing.T) {
+	ctx := context.Background()
+
+	gater := NewConnectionGater()
+	h1 := setupQUICHost(t, libp2p.ConnectionGater(gater))
+	h2 := setupQUICHost(t)
+	h3 := setupQUICHost(t)
+	pinfo1 := peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}
+
+	// Everything is allowed by default.
+	err := h2.Connect(ctx, pinfo1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gater.DenyPeers(h3.ID())
+	err = h3.Connect(ctx, pinfo1)
+	if err == nil && len(h1.Network().ConnsToPeer(h3.ID())) > 0 {
+		t.Error("h3 should not be able to connect")
+	}
+	if st := gater.Stats(); st.RejectedAccepts == 0 {
+		t.Error("expected rejected accepts:", st)
+	}
+	err = h1.Connect(ctx, peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()})
+	if err == nil {
+		t.Error("h1 should not dial h3")
+	}
+	if st := gater.Stats(); st.RejectedDials == 0 {
+		t.Error("expected rejected dials:", st)
+	}
+	gater.RemoveDeniedPeers(h3.ID())
+
+	gater.DenyCIDRs(netip.MustParsePrefix("127.0.0.0/8"))
+	err = h1.Connect(ctx, peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()})
+	if err == nil {
+		t.Error("h1 should not dial addresses in a denied range")
+	}
+	gater.RemoveDeniedCIDRs(netip.MustParsePrefix("127.0.0.0/8"))
+
+	gater.AllowCIDRs(netip.MustParsePrefix("10.0.0.0/8"))
+	if gater.IsAllowedAddr(multiaddr.StringCast("/ip4/127.0.0.1/udp/1/quic-v1")) {
+		t.Error("address outside the allowed ranges should not be allowed")
+	}
+	if !gater.IsAllowedAddr(multiaddr.StringCast("/ip4/10.1.2.3/udp/1/quic-v1")) {
+		t.Error("address in an allowed range should be allowed")
+	}
+	gater.RemoveAllowedCIDRs(netip.MustParsePrefix("10.0.0.0/8"))
+
+	err = h1.Connect(ctx, peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()})
+	if err != nil {
+		t.Error(err)
+	}
+}
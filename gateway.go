@@ -0,0 +1,80 @@
+package ipfslite
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ipfs/boxo/gateway"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GatewayParams contains the options for GatewayHandler.
+type GatewayParams struct {
+	// Trustless disables deserialized responses, so that the gateway only
+	// serves verifiable raw blocks, CAR streams and IPNS records, as
+	// defined by the Trustless Gateway specification. Requests for
+	// rendered content are rejected with a 406 response.
+	Trustless bool
+	// RetrievalTimeout is the maximum time to wait for content to start
+	// arriving, and between subsequent writes, before aborting a
+	// request. Defaults to 30 seconds.
+	RetrievalTimeout time.Duration
+	// MaxConcurrentRequests limits the number of requests being served
+	// at the same time. Additional requests receive a 429 response.
+	// Defaults to 4096.
+	MaxConcurrentRequests int
+	// MetricsRegistry is used to register the gateway metrics. Defaults
+	// to the global Prometheus registry.
+	MetricsRegistry prometheus.Registerer
+}
+
+func (params *GatewayParams) setDefaults() {
+	if params.RetrievalTimeout <= 0 {
+		params.RetrievalTimeout = gateway.DefaultRetrievalTimeout
+	}
+	if params.MaxConcurrentRequests <= 0 {
+		params.MaxConcurrentRequests = gateway.DefaultMaxConcurrentRequests
+	}
+}
+
+// GatewayHandler returns an http.Handler which implements an IPFS HTTP
+// path gateway serving content from this Peer. It handles requests for
+// "/ipfs/<cid>[/path]" and "/ipns/<name>[/path]", rendering UnixFS files
+// (with content-type sniffing and Range requests) and directory listings.
+// Responses for immutable content carry ETag and Cache-Control headers
+// so that they can be cached indefinitely.
+//
+// The handler also implements the Trustless Gateway specification, which
+// lets clients verify everything they receive: "?format=raw" (or an
+// "Accept: application/vnd.ipld.raw" header) returns a single block, and
+// "?format=car" (or "Accept: application/vnd.ipld.car") returns a CAR
+// stream. CAR responses support the "dag-scope" (block, entity, all) query
+// parameter and, along with "dag-scope=entity", the "entity-bytes"
+// parameter to only include the blocks for a byte range of a file (for
+// example "entity-bytes=0:1023").
+//
+// Content not available locally is fetched from the network, like with
+// any other Peer operation. The handler should be mounted on the root of
+// an http.ServeMux, or on the "/ipfs/" and "/ipns/" prefixes.
+func (p *Peer) GatewayHandler(params *GatewayParams) (http.Handler, error) {
+	if params == nil {
+		params = &GatewayParams{}
+	}
+	params.setDefaults()
+
+	backend, err := gateway.NewBlocksBackend(
+		p.bserv,
+		gateway.WithNameSystem(p.namesys),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := gateway.Config{
+		DeserializedResponses: !params.Trustless,
+		RetrievalTimeout:      params.RetrievalTimeout,
+		MaxConcurrentRequests: params.MaxConcurrentRequests,
+		MetricsRegistry:       params.MetricsRegistry,
+	}
+	return gateway.NewHandler(cfg, backend), nil
+}
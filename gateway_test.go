@@ -0,0 +1,268 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func setupGateway(t *testing.T, p *Peer, params *GatewayParams) *httptest.Server {
+	t.Helper()
+	if params == nil {
+		params = &GatewayParams{}
+	}
+	params.MetricsRegistry = prometheus.NewRegistry()
+	h, err := p.GatewayHandler(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func gatewayGet(t *testing.T, url string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestGatewayHandler(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+	srv := setupGateway(t, p, nil)
+
+	html := "<!DOCTYPE html><html><body>hello</body></html>"
+	fsys := fstest.MapFS{
+		"index.txt":      {Data: []byte("0123456789")},
+		"sub/page.html":  {Data: []byte(html)},
+		"sub/other.html": {Data: []byte(html)},
+	}
+	nd, err := p.AddDirectory(ctx, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := "/ipfs/" + nd.Cid().String()
+
+	t.Run("file", func(t *testing.T) {
+		resp, body := gatewayGet(t, srv.URL+root+"/index.txt", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+		}
+		if string(body) != "0123456789" {
+			t.Errorf("unexpected body %q", body)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		if etag := resp.Header.Get("Etag"); etag == "" {
+			t.Error("expected an Etag")
+		}
+		if cc := resp.Header.Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+			t.Errorf("expected immutable Cache-Control, got %q", cc)
+		}
+
+		resp, _ = gatewayGet(t, srv.URL+root+"/index.txt", http.Header{
+			"If-None-Match": {resp.Header.Get("Etag")},
+		})
+		if resp.StatusCode != http.StatusNotModified {
+			t.Errorf("expected 304, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		resp, body := gatewayGet(t, srv.URL+root+"/index.txt", http.Header{
+			"Range": {"bytes=2-5"},
+		})
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("expected 206, got %d: %s", resp.StatusCode, body)
+		}
+		if string(body) != "2345" {
+			t.Errorf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("sniffing", func(t *testing.T) {
+		resp, body := gatewayGet(t, srv.URL+root+"/sub/page.html", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("unexpected content type %q", ct)
+		}
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		resp, body := gatewayGet(t, srv.URL+root+"/sub/", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+		}
+		for _, name := range []string{"page.html", "other.html"} {
+			if !strings.Contains(string(body), name) {
+				t.Errorf("listing does not contain %s", name)
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		resp, _ := gatewayGet(t, srv.URL+root+"/missing", nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", resp.StatusCode)
+		}
+	})
+}
+
+// readCAR returns the CIDs of the blocks in a CAR stream, checking that
+// every block matches its CID.
+func readCAR(t *testing.T, body []byte) []cid.Cid {
+	t.Helper()
+	br, err := carv2.NewBlockReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cids []cid.Cid
+	for {
+		blk, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := blk.Cid().Prefix().Sum(blk.RawData())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.Equals(blk.Cid()) {
+			t.Fatalf("block %s does not match its data", blk.Cid())
+		}
+		cids = append(cids, blk.Cid())
+	}
+	return cids
+}
+
+func TestGatewayTrustless(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+	srv := setupGateway(t, p, &GatewayParams{Trustless: true})
+
+	// 4 distinct leaves of 1KiB each under a single root.
+	content := make([]byte, 4096)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	nd, err := p.AddFile(ctx, bytes.NewReader(content), &AddParams{
+		Chunker:   "size-1024",
+		RawLeaves: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links()) != 4 {
+		t.Fatalf("expected 4 leaves, got %d", len(nd.Links()))
+	}
+	root := "/ipfs/" + nd.Cid().String()
+
+	t.Run("raw", func(t *testing.T) {
+		resp, body := gatewayGet(t, srv.URL+root+"?format=raw", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.ipld.raw" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		c, err := nd.Cid().Prefix().Sum(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.Equals(nd.Cid()) {
+			t.Error("raw block does not match the requested CID")
+		}
+
+		leaf := nd.Links()[0].Cid
+		resp, body = gatewayGet(t, srv.URL+"/ipfs/"+leaf.String(), http.Header{
+			"Accept": {"application/vnd.ipld.raw"},
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+		}
+		if !bytes.Equal(body, content[:1024]) {
+			t.Error("unexpected leaf block")
+		}
+	})
+
+	t.Run("car", func(t *testing.T) {
+		cases := []struct {
+			query  string
+			blocks int
+		}{
+			{"", 5},
+			{"&dag-scope=all", 5},
+			{"&dag-scope=entity", 5},
+			{"&dag-scope=block", 1},
+			{"&dag-scope=entity&entity-bytes=0:1023", 2},
+			{"&dag-scope=entity&entity-bytes=1024:2047", 2},
+			{"&dag-scope=entity&entity-bytes=2048:*", 3},
+			{"&dag-scope=entity&entity-bytes=-1024:*", 2},
+		}
+		for _, tc := range cases {
+			resp, body := gatewayGet(t, srv.URL+root+"?format=car"+tc.query, nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s: unexpected status %d: %s", tc.query, resp.StatusCode, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/vnd.ipld.car") {
+				t.Errorf("%s: unexpected content type %q", tc.query, ct)
+			}
+			cids := readCAR(t, body)
+			if len(cids) != tc.blocks {
+				t.Errorf("%s: expected %d blocks, got %d", tc.query, tc.blocks, len(cids))
+			}
+			if len(cids) > 0 && !cids[0].Equals(nd.Cid()) {
+				t.Errorf("%s: the first block is not the root", tc.query)
+			}
+		}
+	})
+
+	t.Run("car accept header", func(t *testing.T) {
+		resp, body := gatewayGet(t, srv.URL+root+"?dag-scope=block", http.Header{
+			"Accept": {"application/vnd.ipld.car"},
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+		}
+		if cids := readCAR(t, body); len(cids) != 1 {
+			t.Errorf("expected 1 block, got %d", len(cids))
+		}
+	})
+
+	t.Run("deserialized", func(t *testing.T) {
+		resp, _ := gatewayGet(t, srv.URL+root, nil)
+		if resp.StatusCode != http.StatusNotAcceptable {
+			t.Errorf("expected 406, got %d", resp.StatusCode)
+		}
+	})
+}
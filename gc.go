@@ -0,0 +1,127 @@
+package ipfslite
+
+import (
+	"context"
+
+	"github.com/ipfs/boxo/blockservice"
+	blockstore "github.com/ipfs/boxo/blockstore"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ipfspinner "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// gcLockedDAGService prevents Add and AddMany from running while the
+// blockstore is being garbage collected.
+type gcLockedDAGService struct {
+	ipld.DAGService
+	locker blockstore.GCLocker
+}
+
+func (dag *gcLockedDAGService) Add(ctx context.Context, nd ipld.Node) error {
+	defer dag.locker.PinLock(ctx).Unlock(ctx)
+	return dag.DAGService.Add(ctx, nd)
+}
+
+func (dag *gcLockedDAGService) AddMany(ctx context.Context, nds []ipld.Node) error {
+	defer dag.locker.PinLock(ctx).Unlock(ctx)
+	return dag.DAGService.AddMany(ctx, nds)
+}
+
+// GCResult summarizes a garbage collection run.
+type GCResult struct {
+	// Removed is the number of blocks deleted from the blockstore.
+	Removed int
+	// FreedBytes is the sum of the sizes of the deleted blocks.
+	FreedBytes uint64
+}
+
+// GC performs a mark-and-sweep garbage collection of the blockstore: every
+// block that is not part of a pinned DAG is deleted. Pinned DAGs must be
+// fully available locally, otherwise no blocks are deleted and an error is
+// returned. Adding content or pinning are blocked until GC finishes.
+func (p *Peer) GC(ctx context.Context) (GCResult, error) {
+	var res GCResult
+
+	defer p.bstore.GCLock(ctx).Unlock(ctx)
+
+	marked, err := p.markPinned(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys, err := p.bstore.AllKeysChan(ctx)
+	if err != nil {
+		return res, err
+	}
+	for c := range keys {
+		if marked.Has(gcKey(c)) {
+			continue
+		}
+		size, err := p.bstore.GetSize(ctx, c)
+		if err != nil {
+			return res, err
+		}
+		err = p.bstore.DeleteBlock(ctx, c)
+		if err != nil {
+			return res, err
+		}
+		res.Removed++
+		res.FreedBytes += uint64(size)
+	}
+	return res, ctx.Err()
+}
+
+// markPinned returns the set of blocks that should not be garbage collected.
+// Only local blocks are considered.
+func (p *Peer) markPinned(ctx context.Context) (*cid.Set, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	marked := cid.NewSet()
+	visit := func(c cid.Cid) bool {
+		return marked.Visit(gcKey(c))
+	}
+
+	// Read below the quota blockstore, if any, so that marking does not
+	// count as an access when choosing blocks to evict.
+	var bs blockstore.Blockstore = p.bstore
+	if p.quota != nil {
+		bs = p.quota.Blockstore
+	}
+	bserv := blockservice.New(bs, offline.Exchange(bs))
+	getLinks := merkledag.GetLinksWithDAG(merkledag.NewDAGService(bserv))
+
+	for sp := range p.pinner.RecursiveKeys(ctx, false) {
+		if sp.Err != nil {
+			return nil, sp.Err
+		}
+		err := merkledag.Walk(ctx, getLinks, sp.Pin.Key, visit, merkledag.Concurrent())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ch := range []<-chan ipfspinner.StreamedPin{
+		p.pinner.DirectKeys(ctx, false),
+		p.pinner.InternalPins(ctx, false),
+	} {
+		for sp := range ch {
+			if sp.Err != nil {
+				return nil, sp.Err
+			}
+			visit(sp.Pin.Key)
+		}
+	}
+	return marked, nil
+}
+
+// gcKey normalizes CIDs to the form returned by the blockstore, since
+// blocks are stored by multihash.
+func gcKey(c cid.Cid) cid.Cid {
+	return cid.NewCidV1(cid.Raw, c.Hash())
+}
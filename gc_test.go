@@ -0,0 +1,64 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+)
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	content := make([]byte, 1<<20)
+	_, err := rand.Read(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := p.AddFile(ctx, bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Pin(ctx, pinned.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unpinned, err := p.AddFile(ctx, bytes.NewReader([]byte("garbage")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 1 || res.FreedBytes != uint64(len(unpinned.RawData())) {
+		t.Errorf("unexpected GC result: %+v", res)
+	}
+
+	if ok, _ := p.HasBlock(ctx, unpinned.Cid()); ok {
+		t.Error("unpinned block should have been removed")
+	}
+	if ok, _ := p.HasBlock(ctx, pinned.Cid()); !ok {
+		t.Error("pinned block should have been kept")
+	}
+	for _, l := range pinned.Links() {
+		if ok, _ := p.HasBlock(ctx, l.Cid); !ok {
+			t.Error("blocks in pinned DAGs should have been kept")
+		}
+	}
+
+	err = p.Unpin(ctx, pinned.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = p.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != len(pinned.Links())+1 {
+		t.Errorf("expected all blocks to be removed: %+v", res)
+	}
+}
@@ -0,0 +1,116 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// ErrInsecureKeyFile is returned by LoadIdentity when the key file can be
+// read or written by users other than its owner.
+var ErrInsecureKeyFile = errors.New("key file permissions are too open (should be 0600)")
+
+// identityDatastoreKey is where the private key is stored by
+// LoadOrCreateDatastoreIdentity.
+var identityDatastoreKey = datastore.NewKey("identity")
+
+// GenerateIdentity returns a new Ed25519 private key which can be used as
+// libp2p host identity (i.e. with SetupLibp2p).
+func GenerateIdentity() (crypto.PrivKey, error) {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	return priv, err
+}
+
+// SaveIdentity writes the given private key to a file, readable and writable
+// only by its owner. An existing file is overwritten.
+func SaveIdentity(path string, priv crypto.PrivKey) error {
+	data, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	// The file might have existed with other permissions.
+	err = f.Chmod(0o600)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadIdentity reads a private key written by SaveIdentity. It returns
+// ErrInsecureKeyFile when the file is accessible by users other than its
+// owner (except on Windows, where permissions are not checked).
+func LoadIdentity(path string) (crypto.PrivKey, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrInsecureKeyFile)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.UnmarshalPrivateKey(data)
+}
+
+// LoadOrCreateIdentity loads the private key from the given file. If the file
+// does not exist, a new key is generated with GenerateIdentity and saved to
+// it, so that the host keeps its peer ID across restarts.
+func LoadOrCreateIdentity(path string) (crypto.PrivKey, error) {
+	priv, err := LoadIdentity(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return priv, err
+	}
+
+	priv, err = GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return priv, SaveIdentity(path, priv)
+}
+
+// LoadOrCreateDatastoreIdentity works like LoadOrCreateIdentity but keeps the
+// private key in the given datastore (usually the one used for the Peer).
+// Note that the key is stored unencrypted.
+func LoadOrCreateDatastoreIdentity(ctx context.Context, ds datastore.Datastore) (crypto.PrivKey, error) {
+	data, err := ds.Get(ctx, identityDatastoreKey)
+	if err == nil {
+		return crypto.UnmarshalPrivateKey(data)
+	}
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return nil, err
+	}
+
+	priv, err := GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	data, err = crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	err = ds.Put(ctx, identityDatastoreKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return priv, ds.Sync(ctx, identityDatastoreKey)
+}
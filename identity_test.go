@@ -0,0 +1,72 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.key")
+
+	priv, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected key file permissions: %s", fi.Mode().Perm())
+	}
+
+	priv2, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !priv.Equals(priv2) {
+		t.Error("loaded a different key")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	err = os.Chmod(path, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadIdentity(path)
+	if !errors.Is(err, ErrInsecureKeyFile) {
+		t.Error("expected ErrInsecureKeyFile, got:", err)
+	}
+	// Saving fixes the permissions.
+	err = SaveIdentity(path, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadIdentity(path)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadOrCreateDatastoreIdentity(t *testing.T) {
+	ctx := context.Background()
+	ds := NewInMemoryDatastore()
+
+	priv, err := LoadOrCreateDatastoreIdentity(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv2, err := LoadOrCreateDatastoreIdentity(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !priv.Equals(priv2) {
+		t.Error("loaded a different key")
+	}
+}
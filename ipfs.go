@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/ipfs/boxo/bitswap"
 	"github.com/ipfs/boxo/bitswap/client"
 	"github.com/ipfs/boxo/bitswap/network/bsnet"
@@ -24,6 +25,11 @@ import (
 	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
 	"github.com/ipfs/boxo/ipld/unixfs/importer/trickle"
 	ufsio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path/resolver"
+	"github.com/ipfs/boxo/peering"
+	ipfspinner "github.com/ipfs/boxo/pinning/pinner"
 	provider "github.com/ipfs/boxo/provider"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
@@ -32,6 +38,8 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	madns "github.com/multiformats/go-multiaddr-dns"
 	"github.com/multiformats/go-multihash"
 )
 
@@ -48,6 +56,11 @@ type Config struct {
 	Offline bool
 	// ReprovideInterval sets how often to reprovide records to the DHT
 	ReprovideInterval time.Duration
+	// ReprovideStrategy selects which blocks are reprovided to the DHT:
+	// ReprovideAll (default), ReprovidePinned or ReprovideRoots. Kubo's
+	// "pinned+mfs" is not offered, as IPFS-Lite has no MFS. New fails
+	// with any other value.
+	ReprovideStrategy string
 	// Disables wrapping the blockstore in an ARC cache + Bloomfilter. Use
 	// when the given blockstore or datastore already has caching, or when
 	// caching is not needed.
@@ -62,12 +75,72 @@ type Config struct {
 	// broadcasting to pending peers beneficial for timely block discovery.
 	// Default is false.
 	BitswapBroadcastControlSendToPendingPeers bool
+	// ProvideOnAdd announces content to the network as soon as it is
+	// added with Add, AddMany, AddFile, AddDirectory or ImportCAR, rather
+	// than waiting for the next reprovide run. Only the roots of files,
+	// directories and CARs are announced right away.
+	ProvideOnAdd bool
+	// MaxBlockstoreSize sets a quota, in bytes, for the total size of the
+	// blocks in the blockstore. When exceeded, blocks which are not pinned
+	// are evicted, least recently used first. The size of all the blocks
+	// is calculated when the Peer is created, which may take a while with
+	// large blockstores. Default is 0 (no quota).
+	MaxBlockstoreSize uint64
+	// RefuseWritesOverQuota makes writes that would exceed the
+	// MaxBlockstoreSize fail with ErrQuotaExceeded rather than evicting
+	// older blocks.
+	RefuseWritesOverQuota bool
+	// Peering lists peers that the Peer should stay connected to. See
+	// Peer.AddPeer.
+	Peering []peer.AddrInfo
+	// MDNS enables the discovery of peers in the local network via
+	// mDNS. Discovered peers are connected automatically.
+	MDNS bool
+	// MDNSServiceName sets the mDNS service name that is advertised and
+	// queried. Peers only discover those using the same name. Defaults
+	// to the libp2p one ("_p2p._udp").
+	MDNSServiceName string
+	// NameCacheSize sets the number of resolved IPNS names that are
+	// cached. Defaults to 128.
+	NameCacheSize int
+	// NameResolveDepth limits how many names are followed when a name
+	// points to another one. Defaults to 32.
+	NameResolveDepth int
+	// DNSResolver is used to resolve DNSLink names. Defaults to the
+	// system resolver.
+	DNSResolver DNSResolver
+	// IPNSRepublishInterval sets how often the IPNS records published
+	// with PublishName are republished, so that they do not expire.
+	// Defaults to 4 hours. Set to a negative value to disable
+	// republishing.
+	IPNSRepublishInterval time.Duration
+	// Keystore sets the keystore for named keys (see Peer.CreateKey).
+	// Defaults to a Keystore in the Peer's datastore.
+	Keystore keystore.Keystore
+	// KeystorePassphrase, when set, is used to encrypt the keys in the
+	// default keystore.
+	KeystorePassphrase string
 }
 
 func (cfg *Config) setDefaults() {
 	if cfg.ReprovideInterval == 0 {
 		cfg.ReprovideInterval = defaultReprovideInterval
 	}
+	if cfg.NameCacheSize <= 0 {
+		cfg.NameCacheSize = defaultNameCacheSize
+	}
+	if cfg.NameResolveDepth <= 0 {
+		cfg.NameResolveDepth = defaultNameResolveDepth
+	}
+	if cfg.DNSResolver == nil {
+		cfg.DNSResolver = madns.DefaultResolver
+	}
+	if cfg.IPNSRepublishInterval == 0 {
+		cfg.IPNSRepublishInterval = defaultIPNSRepublishInterval
+	}
+	if cfg.ReprovideStrategy == "" {
+		cfg.ReprovideStrategy = ReprovideAll
+	}
 	if bbmrp := cfg.BitswapBroadcastMaxRandomPeers; bbmrp == 0 {
 		cfg.BitswapBroadcastMaxRandomPeers = defaultBitswapBroadcastMaxRandomPeers
 	} else if bbmrp < 0 {
@@ -78,7 +151,8 @@ func (cfg *Config) setDefaults() {
 // Peer is an IPFS-Lite peer. It provides a DAG service that can fetch and put
 // blocks from/to the IPFS network.
 type Peer struct {
-	ctx context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	cfg *Config
 
@@ -87,10 +161,26 @@ type Peer struct {
 	store datastore.Batching
 
 	ipld.DAGService // become a DAG service
+	dag             ipld.DAGService
 	exch            exchange.Interface
-	bstore          blockstore.Blockstore
+	bstore          blockstore.GCBlockstore
+	quota           *quotaBlockstore
 	bserv           blockservice.BlockService
 	reprovider      provider.System
+	provideStats    *provideTracker
+	resolver        resolver.Resolver
+	pinner          ipfspinner.Pinner
+	peering         *peering.PeeringService
+	mdns            mdns.Service
+	namesys         namesys.NameSystem
+	nameCache       *lru.Cache[string, nameCacheEntry]
+	nameKeys        keystore.Keystore
+	keystore        keystore.Keystore
+	stopRepublisher func()
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // New creates an IPFS-Lite Peer. It uses the given datastore, blockstore,
@@ -98,6 +188,9 @@ type Peer struct {
 // given datastore will be wrapped to create one. The Host and the Routing may
 // be nil if config.Offline is set to true, as they are not used in that
 // case. Peer implements the ipld.DAGService interface.
+//
+// The Peer is closed when the given context is cancelled or when Close is
+// called.
 func New(
 	ctx context.Context,
 	datastore datastore.Batching,
@@ -112,15 +205,25 @@ func New(
 
 	cfg.setDefaults()
 
+	ctx, cancel := context.WithCancel(ctx)
 	p := &Peer{
-		ctx:   ctx,
-		cfg:   cfg,
-		host:  host,
-		dht:   dht,
-		store: datastore,
+		ctx:    ctx,
+		cancel: cancel,
+		cfg:    cfg,
+		host:   host,
+		dht:    dht,
+		store:  datastore,
 	}
 
-	err := p.setupBlockstore(blockstore)
+	// On error, tear down whatever has been set up.
+	var err error
+	defer func() {
+		if err != nil {
+			_ = p.Close()
+		}
+	}()
+
+	err = p.setupBlockstore(blockstore)
 	if err != nil {
 		return nil, err
 	}
@@ -130,15 +233,44 @@ func New(
 	}
 	err = p.setupDAGService()
 	if err != nil {
-		_ = p.bserv.Close()
+		return nil, err
+	}
+	err = p.setupPinner()
+	if err != nil {
+		return nil, err
+	}
+	err = p.setupResolver()
+	if err != nil {
 		return nil, err
 	}
 	err = p.setupReprovider()
 	if err != nil {
-		_ = p.bserv.Close()
+		return nil, err
+	}
+	err = p.setupKeystore()
+	if err != nil {
+		return nil, err
+	}
+	err = p.setupNameSystem()
+	if err != nil {
+		return nil, err
+	}
+	err = p.setupPeering()
+	if err != nil {
+		return nil, err
+	}
+	err = p.setupMDNS()
+	if err != nil {
 		return nil, err
 	}
 
+	if p.quota != nil && !p.cfg.RefuseWritesOverQuota {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.evictLoop()
+		}()
+	}
 	go p.autoclose()
 
 	return p, nil
@@ -161,7 +293,15 @@ func (p *Peer) setupBlockstore(bs blockstore.Blockstore) error {
 			return err
 		}
 	}
-	p.bstore = bs
+
+	if p.cfg.MaxBlockstoreSize > 0 {
+		p.quota, err = newQuotaBlockstore(p.ctx, bs, p.cfg.MaxBlockstoreSize, p.cfg.RefuseWritesOverQuota)
+		if err != nil {
+			return err
+		}
+		bs = p.quota
+	}
+	p.bstore = blockstore.NewGCBlockstore(bs, blockstore.NewGCLocker())
 	return nil
 }
 
@@ -192,83 +332,130 @@ func (p *Peer) setupBlockService() error {
 }
 
 func (p *Peer) setupDAGService() error {
-	p.DAGService = merkledag.NewDAGService(p.bserv)
+	p.dag = merkledag.NewDAGService(p.bserv)
+	// Additions made through the exported DAGService cannot happen
+	// in the middle of a GC run.
+	p.DAGService = &gcLockedDAGService{DAGService: p.dag, locker: p.bstore}
+	if p.cfg.ProvideOnAdd {
+		p.DAGService = &providingDAGService{DAGService: p.DAGService, peer: p}
+	}
 	return nil
 }
 
+// localBlockService returns a BlockService which only uses local blocks.
+func (p *Peer) localBlockService() blockservice.BlockService {
+	return blockservice.New(p.bstore, offline.Exchange(p.bstore))
+}
+
 func (p *Peer) setupReprovider() error {
 	if p.cfg.Offline || p.cfg.ReprovideInterval < 0 {
 		p.reprovider = provider.NewNoopProvider()
 		return nil
 	}
 
-	prov, err := provider.New(p.store,
+	keyProvider, err := p.reprovideKeyProvider()
+	if err != nil {
+		return err
+	}
+
+	p.provideStats = newProvideTracker()
+	opts := []provider.Option{
 		provider.DatastorePrefix(datastore.NewKey("repro")),
-		provider.Online(p.dht),
 		provider.ReproviderInterval(p.cfg.ReprovideInterval),
-		provider.KeyProvider(p.bstore.AllKeysChan))
+		provider.KeyProvider(keyProvider),
+	}
+	// Without routing, the provider system only keeps the queue.
+	if p.dht != nil {
+		opts = append(opts, provider.Online(p.provideStats.wrapRouting(p.dht)))
+	}
+	prov, err := provider.New(p.store, opts...)
 	if err != nil {
 		return err
 	}
-	p.reprovider = prov
+	p.reprovider = p.provideStats.wrapSystem(prov)
 
 	return nil
 }
 
 func (p *Peer) autoclose() {
 	<-p.ctx.Done()
-	_ = p.reprovider.Close()
-	_ = p.bserv.Close()
+	err := p.Close()
+	if err != nil {
+		logger.Errorf("closing peer: %s", err)
+	}
 }
 
-// Bootstrap is an optional helper to connect to the given peers and bootstrap
-// the Peer DHT (and Bitswap). This is a best-effort function. Errors are only
-// logged and a warning is printed when less than half of the given peers
-// could be contacted. It is fine to pass a list where some peers will not be
-// reachable.
-func (p *Peer) Bootstrap(peers []peer.AddrInfo) {
-	connected := make(chan struct{})
-
-	var wg sync.WaitGroup
-	for _, pinfo := range peers {
-		// h.Peerstore().AddAddrs(pinfo.ID, pinfo.Addrs, peerstore.PermanentAddrTTL)
-		wg.Add(1)
-		go func(pinfo peer.AddrInfo) {
-			defer wg.Done()
-			err := p.host.Connect(p.ctx, pinfo)
+// Close shuts down the Peer: it stops mDNS discovery, the peering service,
+// the IPNS republisher and the reprovider, flushes and closes the pinner,
+// stops Bitswap and the blockservice and finally syncs the datastore once all
+// background tasks have finished. It is safe to call Close several times, and
+// concurrently with the cancellation of the context given to New. Every call
+// returns the errors (if any) of the first one. The libp2p Host, the DHT and
+// the datastore are not closed, as they are owned by the caller.
+func (p *Peer) Close() error {
+	p.closeOnce.Do(func() {
+		// Use a fresh context, as the Peer's one may be cancelled
+		// already.
+		ctx := context.Background()
+		var errs []error
+
+		if p.mdns != nil {
+			err := p.mdns.Close()
 			if err != nil {
-				logger.Warn(err)
-				return
+				errs = append(errs, fmt.Errorf("closing mDNS: %w", err))
 			}
-			logger.Info("Connected to", pinfo.ID)
-			connected <- struct{}{}
-		}(pinfo)
-	}
+		}
+		if p.peering != nil {
+			p.peering.Stop()
+		}
+		if p.stopRepublisher != nil {
+			p.stopRepublisher()
+		}
 
-	go func() {
-		wg.Wait()
-		close(connected)
-	}()
+		// Components may be missing when New failed.
+		if p.reprovider != nil {
+			err := p.reprovider.Close()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("closing reprovider: %w", err))
+			}
+		}
 
-	i := 0
-	for range connected {
-		i++
-	}
-	if nPeers := len(peers); i < nPeers/2 {
-		logger.Warnf("only connected to %d bootstrap peers out of %d", i, nPeers)
-	}
+		if p.pinner != nil {
+			err := p.pinner.Flush(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("flushing pinner: %w", err))
+			}
+			err = p.pinner.Close()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("closing pinner: %w", err))
+			}
+		}
 
-	err := p.dht.Bootstrap(p.ctx)
-	if err != nil {
-		logger.Error(err)
-		return
-	}
+		// Closing the blockservice closes the exchange (Bitswap).
+		if p.bserv != nil {
+			err := p.bserv.Close()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("closing blockservice: %w", err))
+			}
+		}
+
+		p.cancel()
+		p.wg.Wait()
+
+		err := p.store.Sync(ctx, datastore.NewKey("/"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("syncing datastore: %w", err))
+		}
+
+		p.closeErr = errors.Join(errs...)
+	})
+	return p.closeErr
 }
 
 // Session returns a session-based NodeGetter.
 func (p *Peer) Session(ctx context.Context) ipld.NodeGetter {
-	ng := merkledag.NewSession(ctx, p.DAGService)
-	if ng == p.DAGService {
+	ng := merkledag.NewSession(ctx, p.dag)
+	if ng == p.dag {
 		logger.Warn("DAGService does not support sessions")
 	}
 	return ng
@@ -280,20 +467,18 @@ type AddParams struct {
 	Layout    string
 	Chunker   string
 	RawLeaves bool
-	Hidden    bool
-	Shard     bool
-	NoCopy    bool
-	HashFun   string
-	MaxLinks  int
+	// Hidden includes files and folders starting with a dot when adding
+	// directories.
+	Hidden bool
+	// Shard makes every added directory a HAMT-sharded directory, rather
+	// than only those that are too large for a single block.
+	Shard    bool
+	NoCopy   bool
+	HashFun  string
+	MaxLinks int
 }
 
-// AddFile chunks and adds content to the DAGService from a reader. The content
-// is stored as a UnixFS DAG (default for IPFS). It returns the root
-// ipld.Node.
-func (p *Peer) AddFile(ctx context.Context, r io.Reader, params *AddParams) (ipld.Node, error) {
-	if params == nil {
-		params = &AddParams{}
-	}
+func (params *AddParams) setDefaults() {
 	if params.HashFun == "" {
 		params.HashFun = "sha2-256"
 	}
@@ -301,7 +486,9 @@ func (p *Peer) AddFile(ctx context.Context, r io.Reader, params *AddParams) (ipl
 	if params.MaxLinks == 0 {
 		params.MaxLinks = helpers.DefaultLinksPerBlock
 	}
+}
 
+func (params *AddParams) cidBuilder() (cid.Builder, error) {
 	prefix, err := merkledag.PrefixForCidVersion(1)
 	if err != nil {
 		return nil, fmt.Errorf("bad CID Version: %s", err)
@@ -313,13 +500,43 @@ func (p *Peer) AddFile(ctx context.Context, r io.Reader, params *AddParams) (ipl
 	}
 	prefix.MhType = hashFunCode
 	prefix.MhLength = -1
+	return &prefix, nil
+}
+
+// AddFile chunks and adds content to the DAGService from a reader. The content
+// is stored as a UnixFS DAG (default for IPFS). It returns the root
+// ipld.Node.
+func (p *Peer) AddFile(ctx context.Context, r io.Reader, params *AddParams) (ipld.Node, error) {
+	if params == nil {
+		params = &AddParams{}
+	}
+	params.setDefaults()
+
+	prefix, err := params.cidBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	defer p.bstore.PinLock(ctx).Unlock(ctx)
+	n, err := p.addFile(r, params, prefix)
+	if err != nil {
+		return nil, err
+	}
+	err = p.recordRoots(ctx, n.Cid())
+	if err != nil {
+		return nil, err
+	}
+	p.provideOnAdd(ctx, n.Cid())
+	return n, nil
+}
 
+func (p *Peer) addFile(r io.Reader, params *AddParams, prefix cid.Builder) (ipld.Node, error) {
 	dbp := helpers.DagBuilderParams{
-		Dagserv:    p,
+		Dagserv:    p.dag,
 		RawLeaves:  params.RawLeaves,
 		Maxlinks:   params.MaxLinks,
 		NoCopy:     params.NoCopy,
-		CidBuilder: &prefix,
+		CidBuilder: prefix,
 	}
 
 	chnk, err := chunker.FromString(r, params.Chunker)
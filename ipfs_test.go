@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/hex"
 	"io"
+	"sync"
 	"testing"
 
 	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
 	multiaddr "github.com/multiformats/go-multiaddr"
@@ -94,6 +96,17 @@ func setupPeers(t *testing.T) (p1, p2 *Peer, closer func(t *testing.T)) {
 	return
 }
 
+func setupOfflinePeer(t *testing.T) *Peer {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	p, err := New(ctx, NewInMemoryDatastore(), nil, nil, nil, &Config{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
 func TestDAG(t *testing.T) {
 	ctx := context.Background()
 	p1, p2, closer := setupPeers(t)
@@ -196,3 +209,54 @@ func TestFiles(t *testing.T) {
 		t.Error("different content put and retrieved")
 	}
 }
+
+func TestClose(t *testing.T) {
+	p1, p2, closer := setupPeers(t)
+
+	var wg sync.WaitGroup
+	for _, p := range []*Peer{p1, p2, p1} {
+		wg.Add(1)
+		go func(p *Peer) {
+			defer wg.Done()
+			err := p.Close()
+			if err != nil {
+				t.Error(err)
+			}
+		}(p)
+	}
+	// Cancels the Peers' context concurrently with Close.
+	closer(t)
+	wg.Wait()
+
+	err := p1.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	n, err := p1.AddFile(context.Background(), bytes.NewReader([]byte("hola")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p1.Pin(context.Background(), n.Cid(), true)
+	if err == nil {
+		t.Error("expected an error pinning with a closed peer")
+	}
+}
+
+func TestNewCleanupOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// Fails setting up the reprovider, once the blockservice and the
+	// pinner exist.
+	_, err = New(ctx, NewInMemoryDatastore(), nil, h, nil, &Config{ReprovideStrategy: "nope"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,483 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key types for CreateKey.
+const (
+	KeyTypeEd25519   = "ed25519"
+	KeyTypeRSA       = "rsa"
+	KeyTypeSecp256k1 = "secp256k1"
+)
+
+var (
+	keystoreDatastorePrefix = datastore.NewKey("keystore")
+	defaultRSAKeySize       = 2048
+)
+
+// ErrWrongPassphrase is returned when a key cannot be decrypted with the
+// passphrase of the keystore.
+var ErrWrongPassphrase = errors.New("cannot decrypt key: wrong passphrase or corrupted key")
+
+// Encrypted keys are stored as magic | salt | nonce | ciphertext.
+var encryptedKeyMagic = []byte("ipfslite-enc1")
+
+var keyNameCodec = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+const (
+	encryptedKeySaltSize = 16
+	scryptN              = 1 << 15
+	scryptR              = 8
+	scryptP              = 1
+)
+
+// Keystore stores private keys by name, either in a datastore or in a
+// directory. When a passphrase is given, keys are encrypted with AES-GCM,
+// using a key derived from the passphrase with scrypt. It implements the
+// boxo keystore.Keystore interface.
+type Keystore struct {
+	storage    keyStorage
+	passphrase []byte
+}
+
+var _ keystore.Keystore = (*Keystore)(nil)
+
+// keyStorage stores the serialized keys.
+type keyStorage interface {
+	has(name string) (bool, error)
+	get(name string) ([]byte, error)
+	put(name string, data []byte) error
+	delete(name string) error
+	list() ([]string, error)
+}
+
+// NewDatastoreKeystore returns a Keystore which stores keys in the given
+// datastore. An empty passphrase stores the keys unencrypted.
+func NewDatastoreKeystore(ds datastore.Datastore, passphrase string) *Keystore {
+	return &Keystore{
+		storage:    &datastoreKeyStorage{ds: ds},
+		passphrase: []byte(passphrase),
+	}
+}
+
+// NewDirectoryKeystore returns a Keystore which stores every key in a file in
+// the given directory, which is created if needed. Files are only
+// accessible by their owner. An empty passphrase stores the keys
+// unencrypted.
+func NewDirectoryKeystore(dir, passphrase string) (*Keystore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{
+		storage:    &dirKeyStorage{dir: dir},
+		passphrase: []byte(passphrase),
+	}, nil
+}
+
+func validateKeyName(name string) error {
+	if name == "" {
+		return errors.New("key names must not be empty")
+	}
+	if strings.Contains(name, "/") {
+		return errors.New("key names may not contain slashes")
+	}
+	if strings.HasPrefix(name, ".") {
+		return errors.New("key names may not begin with a period")
+	}
+	return nil
+}
+
+// Has returns whether a key with the given name exists.
+func (ks *Keystore) Has(name string) (bool, error) {
+	if err := validateKeyName(name); err != nil {
+		return false, err
+	}
+	return ks.storage.has(name)
+}
+
+// Put stores a key with the given name. It returns keystore.ErrKeyExists if
+// the name is taken.
+func (ks *Keystore) Put(name string, priv crypto.PrivKey) error {
+	if err := validateKeyName(name); err != nil {
+		return err
+	}
+	has, err := ks.storage.has(name)
+	if err != nil {
+		return err
+	}
+	if has {
+		return keystore.ErrKeyExists
+	}
+
+	data, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	if len(ks.passphrase) > 0 {
+		data, err = encryptKey(ks.passphrase, data)
+		if err != nil {
+			return err
+		}
+	}
+	return ks.storage.put(name, data)
+}
+
+// Get returns the key with the given name, or keystore.ErrNoSuchKey.
+func (ks *Keystore) Get(name string) (crypto.PrivKey, error) {
+	if err := validateKeyName(name); err != nil {
+		return nil, err
+	}
+	data, err := ks.storage.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks.passphrase) > 0 {
+		data, err = decryptKey(ks.passphrase, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return crypto.UnmarshalPrivateKey(data)
+}
+
+// Delete removes the key with the given name.
+func (ks *Keystore) Delete(name string) error {
+	if err := validateKeyName(name); err != nil {
+		return err
+	}
+	return ks.storage.delete(name)
+}
+
+// List returns the names of all the keys.
+func (ks *Keystore) List() ([]string, error) {
+	return ks.storage.list()
+}
+
+func passphraseKey(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptKey(passphrase, data []byte) ([]byte, error) {
+	salt := make([]byte, encryptedKeySaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedKeyMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, encryptedKeyMagic), nil
+}
+
+func decryptKey(passphrase, data []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(data, encryptedKeyMagic)
+	if !ok || len(rest) < encryptedKeySaltSize {
+		return nil, ErrWrongPassphrase
+	}
+	salt, rest := rest[:encryptedKeySaltSize], rest[encryptedKeySaltSize:]
+
+	aead, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, encryptedKeyMagic)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+// datastoreKeyStorage stores keys under base32-encoded names, as names may
+// contain characters with meaning in datastore keys.
+type datastoreKeyStorage struct {
+	ds datastore.Datastore
+}
+
+func (s *datastoreKeyStorage) key(name string) datastore.Key {
+	return datastore.NewKey(keyNameCodec.EncodeToString([]byte(name)))
+}
+
+func (s *datastoreKeyStorage) has(name string) (bool, error) {
+	return s.ds.Has(context.Background(), s.key(name))
+}
+
+func (s *datastoreKeyStorage) get(name string) ([]byte, error) {
+	data, err := s.ds.Get(context.Background(), s.key(name))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, keystore.ErrNoSuchKey
+	}
+	return data, err
+}
+
+func (s *datastoreKeyStorage) put(name string, data []byte) error {
+	ctx := context.Background()
+	err := s.ds.Put(ctx, s.key(name), data)
+	if err != nil {
+		return err
+	}
+	return s.ds.Sync(ctx, s.key(name))
+}
+
+func (s *datastoreKeyStorage) delete(name string) error {
+	return s.ds.Delete(context.Background(), s.key(name))
+}
+
+func (s *datastoreKeyStorage) list() ([]string, error) {
+	res, err := s.ds.Query(context.Background(), query.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name, err := keyNameCodec.DecodeString(datastore.NewKey(entry.Key).BaseNamespace())
+		if err != nil {
+			logger.Warnf("ignoring invalid keystore entry %s", entry.Key)
+			continue
+		}
+		names = append(names, string(name))
+	}
+	return names, nil
+}
+
+// dirKeyStorage stores keys in files named after the base32-encoded key
+// names.
+type dirKeyStorage struct {
+	dir string
+}
+
+func (s *dirKeyStorage) path(name string) string {
+	return filepath.Join(s.dir, "key_"+keyNameCodec.EncodeToString([]byte(name)))
+}
+
+func (s *dirKeyStorage) has(name string) (bool, error) {
+	_, err := os.Stat(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *dirKeyStorage) get(name string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, keystore.ErrNoSuchKey
+	}
+	return data, err
+}
+
+func (s *dirKeyStorage) put(name string, data []byte) error {
+	f, err := os.OpenFile(s.path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return keystore.ErrKeyExists
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *dirKeyStorage) delete(name string) error {
+	return os.Remove(s.path(name))
+}
+
+func (s *dirKeyStorage) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		encoded, ok := strings.CutPrefix(entry.Name(), "key_")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		name, err := keyNameCodec.DecodeString(encoded)
+		if err != nil {
+			logger.Warnf("ignoring invalid keystore file %s", entry.Name())
+			continue
+		}
+		names = append(names, string(name))
+	}
+	return names, nil
+}
+
+func (p *Peer) setupKeystore() error {
+	if p.cfg.Keystore != nil {
+		p.keystore = p.cfg.Keystore
+		return nil
+	}
+	p.keystore = NewDatastoreKeystore(
+		namespace.Wrap(p.store, keystoreDatastorePrefix),
+		p.cfg.KeystorePassphrase,
+	)
+	return nil
+}
+
+// KeyInfo describes a key in the keystore.
+type KeyInfo struct {
+	Name string
+	// ID is the peer ID for the key, which is also its IPNS name.
+	ID peer.ID
+}
+
+// Keystore returns the keystore used by the Peer. Keys in it can be used
+// with PublishName, and their IPNS records are republished automatically.
+func (p *Peer) Keystore() keystore.Keystore {
+	return p.keystore
+}
+
+// CreateKey generates a new key of the given type (KeyTypeEd25519 when
+// empty) and stores it in the keystore with the given name. RSA keys are
+// 2048 bits long.
+func (p *Peer) CreateKey(name, keyType string) (peer.ID, error) {
+	var priv crypto.PrivKey
+	var err error
+	switch strings.ToLower(keyType) {
+	case KeyTypeEd25519, "":
+		priv, _, err = crypto.GenerateEd25519Key(rand.Reader)
+	case KeyTypeRSA:
+		priv, _, err = crypto.GenerateRSAKeyPair(defaultRSAKeySize, rand.Reader)
+	case KeyTypeSecp256k1:
+		priv, _, err = crypto.GenerateSecp256k1Key(rand.Reader)
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return p.putKey(name, priv)
+}
+
+func (p *Peer) putKey(name string, priv crypto.PrivKey) (peer.ID, error) {
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return pid, p.keystore.Put(name, priv)
+}
+
+// ListKeys returns the keys in the keystore.
+func (p *Peer) ListKeys() ([]KeyInfo, error) {
+	names, err := p.keystore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]KeyInfo, 0, len(names))
+	for _, name := range names {
+		priv, err := p.keystore.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, KeyInfo{Name: name, ID: pid})
+	}
+	return keys, nil
+}
+
+// ImportKey stores a private key, serialized like ExportKey does, in the
+// keystore with the given name.
+func (p *Peer) ImportKey(name string, data []byte) (peer.ID, error) {
+	priv, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return "", err
+	}
+	return p.putKey(name, priv)
+}
+
+// ExportKey returns the key with the given name, serialized in the libp2p
+// format (as in SaveIdentity). The result is not encrypted.
+func (p *Peer) ExportKey(name string) ([]byte, error) {
+	priv, err := p.keystore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.MarshalPrivateKey(priv)
+}
+
+// RenameKey changes the name of a key. It fails if the new name is taken.
+func (p *Peer) RenameKey(oldName, newName string) error {
+	priv, err := p.keystore.Get(oldName)
+	if err != nil {
+		return err
+	}
+	err = p.keystore.Put(newName, priv)
+	if err != nil {
+		return err
+	}
+	return p.keystore.Delete(oldName)
+}
+
+// RemoveKey deletes a key from the keystore.
+func (p *Peer) RemoveKey(name string) error {
+	has, err := p.keystore.Has(name)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return keystore.ErrNoSuchKey
+	}
+	return p.keystore.Delete(name)
+}
@@ -0,0 +1,176 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/boxo/keystore"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestKeystore(t *testing.T) {
+	dirKs, err := NewDirectoryKeystore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encDirKs, err := NewDirectoryKeystore(t.TempDir(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ks := range map[string]*Keystore{
+		"datastore":           NewDatastoreKeystore(NewInMemoryDatastore(), ""),
+		"encrypted-datastore": NewDatastoreKeystore(NewInMemoryDatastore(), "secret"),
+		"directory":           dirKs,
+		"encrypted-directory": encDirKs,
+	} {
+		t.Run(name, func(t *testing.T) {
+			priv, err := GenerateIdentity()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ks.Put("my key", priv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ks.Put("my key", priv)
+			if !errors.Is(err, keystore.ErrKeyExists) {
+				t.Error("expected ErrKeyExists")
+			}
+			err = ks.Put("a/b", priv)
+			if err == nil {
+				t.Error("names with slashes should not be allowed")
+			}
+
+			priv2, err := ks.Get("my key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !priv.Equals(priv2) {
+				t.Error("got a different key")
+			}
+
+			names, err := ks.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(names, []string{"my key"}) {
+				t.Error("unexpected key names:", names)
+			}
+
+			err = ks.Delete("my key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ks.Get("my key")
+			if !errors.Is(err, keystore.ErrNoSuchKey) {
+				t.Error("expected ErrNoSuchKey")
+			}
+		})
+	}
+}
+
+func TestKeystoreWrongPassphrase(t *testing.T) {
+	ds := NewInMemoryDatastore()
+	priv, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewDatastoreKeystore(ds, "secret").Put("key", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDatastoreKeystore(ds, "wrong").Get("key")
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Error("expected ErrWrongPassphrase, got:", err)
+	}
+	_, err = NewDatastoreKeystore(ds, "").Get("key")
+	if err == nil {
+		t.Error("encrypted keys should not be readable without passphrase")
+	}
+}
+
+func TestPeerKeys(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	for _, keyType := range []string{KeyTypeEd25519, KeyTypeRSA, KeyTypeSecp256k1} {
+		_, err := p.CreateKey(keyType, keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := p.CreateKey("dsa", "dsa")
+	if err == nil {
+		t.Error("expected an error with an unknown key type")
+	}
+
+	priv, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := p.ImportKey("imported", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.RenameKey("imported", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := p.ExportKey("renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, exported) {
+		t.Error("exported key does not match the imported one")
+	}
+
+	err = p.RemoveKey(KeyTypeRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.RemoveKey(KeyTypeRSA)
+	if !errors.Is(err, keystore.ErrNoSuchKey) {
+		t.Error("expected ErrNoSuchKey")
+	}
+
+	keys, err := p.ListKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Name)
+		if k.Name == "renamed" && k.ID != pid {
+			t.Error("unexpected ID for the renamed key")
+		}
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{KeyTypeEd25519, "renamed", KeyTypeSecp256k1}) {
+		t.Error("unexpected keys:", names)
+	}
+
+	// Keys can be used to publish names.
+	nd, err := p.AddFile(ctx, bytes.NewReader([]byte("named")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := p.Keystore().Get("renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := p.PublishName(ctx, key, "/ipfs/"+nd.Cid().String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name.Peer() != pid {
+		t.Error("name does not match the key")
+	}
+}
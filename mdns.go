@@ -0,0 +1,47 @@
+package ipfslite
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+var mdnsConnectTimeout = 30 * time.Second
+
+func (p *Peer) setupMDNS() error {
+	if p.cfg.Offline || p.host == nil || !p.cfg.MDNS {
+		return nil
+	}
+
+	svc := mdns.NewMdnsService(p.host, p.cfg.MDNSServiceName, (*mdnsNotifee)(p))
+	err := svc.Start()
+	if err != nil {
+		return err
+	}
+	p.mdns = svc
+	return nil
+}
+
+// mdnsNotifee connects to the peers discovered via mDNS. Once connected,
+// they are used by Bitswap and the DHT like any other peer.
+type mdnsNotifee Peer
+
+func (n *mdnsNotifee) HandlePeerFound(pinfo peer.AddrInfo) {
+	p := (*Peer)(n)
+	if pinfo.ID == p.host.ID() {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(p.ctx, mdnsConnectTimeout)
+		defer cancel()
+		err := p.host.Connect(ctx, pinfo)
+		if err != nil {
+			logger.Debugf("connecting to mDNS peer %s: %s", pinfo.ID, err)
+			return
+		}
+		logger.Info("Connected to mDNS peer", pinfo.ID)
+	}()
+}
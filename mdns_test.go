@@ -0,0 +1,70 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+func TestMDNS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{
+		ReprovideInterval: -1,
+		MDNS:              true,
+		MDNSServiceName:   "_ipfs-lite-test._udp",
+	}
+
+	var hosts []host.Host
+	var peers []*Peer
+	for range 2 {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		p, err := New(ctx, NewInMemoryDatastore(), nil, h, nil, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		hosts = append(hosts, h)
+		peers = append(peers, p)
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for hosts[0].Network().Connectedness(hosts[1].ID()) != network.Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("peers did not discover each other")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Bitswap should fetch the content from the discovered peer.
+	content := []byte("found via mDNS")
+	n, err := peers[0].AddFile(ctx, bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getCtx, getCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer getCancel()
+	rsc, err := peers[1].GetFile(getCtx, n.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsc.Close()
+	content2, err := io.ReadAll(rsc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, content2) {
+		t.Error("different content put and retrieved")
+	}
+}
@@ -0,0 +1,213 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/namesys/republisher"
+	"github.com/ipfs/boxo/path"
+	offlinerouting "github.com/ipfs/boxo/routing/offline"
+	record "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+var (
+	defaultNameCacheSize         = 128
+	defaultIPNSRepublishInterval = republisher.DefaultRebroadcastInterval
+	defaultNameResolveDepth      = namesys.DefaultDepthLimit
+	// Used for names whose resolution does not tell how long to cache
+	// them, like DNSLink names resolved with most DNS resolvers.
+	defaultNameCacheTTL = namesys.DefaultResolverCacheTTL
+)
+
+// DNSResolver looks up DNS TXT records, which is needed to resolve DNSLink
+// names like /ipns/example.com. net.DefaultResolver is a DNSResolver. If the
+// resolver also implements madns.TXTWithTTLResolver, the TTL of the TXT
+// records is used to cache the resolved names.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+func dnsLookupFunc(rslv DNSResolver) namesys.LookupTXTWithTTLFunc {
+	if ttlRslv, ok := rslv.(madns.TXTWithTTLResolver); ok {
+		return ttlRslv.LookupTXTWithTTL
+	}
+	return func(ctx context.Context, name string) ([]string, time.Duration, error) {
+		txt, err := rslv.LookupTXT(ctx, name)
+		return txt, 0, err
+	}
+}
+
+type nameCacheEntry struct {
+	path path.Path
+	eol  time.Time
+}
+
+func (p *Peer) setupNameSystem() error {
+	var vs routing.ValueStore = p.dht
+	if p.cfg.Offline || p.dht == nil {
+		// Records are only stored and resolved locally.
+		var validator record.Validator = record.NamespacedValidator{
+			"pk":   record.PublicKeyValidator{},
+			"ipns": ipns.Validator{},
+		}
+		vs = offlinerouting.NewOfflineRouter(p.store, validator)
+	}
+
+	// Caching is done by the Peer, as the namesys cache is not updated
+	// when publishing.
+	ns, err := namesys.NewNameSystem(vs,
+		namesys.WithDatastore(p.store),
+		namesys.WithDNSResolverWithTTL(dnsLookupFunc(p.cfg.DNSResolver)),
+	)
+	if err != nil {
+		return err
+	}
+	p.namesys = ns
+	p.nameCache, err = lru.New[string, nameCacheEntry](p.cfg.NameCacheSize)
+	if err != nil {
+		return err
+	}
+	p.nameKeys = keystore.NewMemKeystore()
+
+	if p.cfg.Offline || p.cfg.IPNSRepublishInterval < 0 || p.host == nil {
+		return nil
+	}
+	self := p.host.Peerstore().PrivKey(p.host.ID())
+	if self == nil {
+		logger.Warn("host private key not available: IPNS records will not be republished")
+		return nil
+	}
+	repub := republisher.NewRepublisher(ns, p.store, self, &republishKeystore{p.keystore, p.nameKeys})
+	repub.Interval = p.cfg.IPNSRepublishInterval
+	p.stopRepublisher = repub.Run()
+	return nil
+}
+
+// PublishName publishes an IPNS record, signed with the given key, which
+// points to the given content path (i.e. /ipfs/<cid>). A nil key uses the
+// host's identity. The TTL tells resolvers how long to cache the record (0
+// uses the IPNS default). Records are valid for 48 hours and are republished
+// every Config.IPNSRepublishInterval while the Peer runs, along with those of
+// any key in the Peer's keystore. It returns the IPNS name, which can be given
+// to ResolveName.
+func (p *Peer) PublishName(ctx context.Context, key crypto.PrivKey, value string, ttl time.Duration) (ipns.Name, error) {
+	if key == nil {
+		if p.host == nil {
+			return ipns.Name{}, ErrOffline
+		}
+		key = p.host.Peerstore().PrivKey(p.host.ID())
+	}
+	pid, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return ipns.Name{}, err
+	}
+
+	pth, err := path.NewPath(value)
+	if err != nil {
+		return ipns.Name{}, err
+	}
+
+	opts := []namesys.PublishOption{namesys.PublishWithEOL(time.Now().Add(ipns.DefaultRecordLifetime))}
+	if ttl > 0 {
+		opts = append(opts, namesys.PublishWithTTL(ttl))
+	}
+	err = p.namesys.Publish(ctx, key, pth, opts...)
+	if err != nil {
+		return ipns.Name{}, err
+	}
+
+	name := ipns.NameFromPeer(pid)
+	if ttl <= 0 {
+		ttl = ipns.DefaultRecordTTL
+	}
+	if pth.Mutable() {
+		// Needs to be resolved recursively.
+		p.nameCache.Remove(name.AsPath().String())
+	} else {
+		p.nameCache.Add(name.AsPath().String(), nameCacheEntry{path: pth, eol: time.Now().Add(ttl)})
+	}
+
+	// Remember the key so that the record is republished.
+	if has, _ := p.nameKeys.Has(pid.String()); !has {
+		err = p.nameKeys.Put(pid.String(), key)
+		if err != nil {
+			return ipns.Name{}, err
+		}
+	}
+	return name, nil
+}
+
+// ResolveName resolves an IPNS name (with or without the /ipns/ prefix) to a
+// content path. Names can be IPNS keys or DNSLink domains. Names that point
+// to other names are followed, up to Config.NameResolveDepth times. Resolved
+// names are cached according to their TTL (1 minute when unknown), up to
+// Config.NameCacheSize.
+func (p *Peer) ResolveName(ctx context.Context, name string) (path.Path, error) {
+	if !strings.HasPrefix(name, ipns.NamespacePrefix) {
+		name = ipns.NamespacePrefix + name
+	}
+	pth, err := path.NewPath(name)
+	if err != nil {
+		return nil, err
+	}
+	// Only the name is cached. The rest of the path is appended to the
+	// resolved one.
+	segments := pth.Segments()
+	namePath, err := path.NewPathFromSegments(segments[:2]...)
+	if err != nil {
+		return nil, err
+	}
+
+	key := namePath.String()
+	if entry, ok := p.nameCache.Get(key); ok && time.Now().Before(entry.eol) {
+		return path.Join(entry.path, segments[2:]...)
+	}
+
+	res, err := p.namesys.Resolve(ctx, namePath, namesys.ResolveWithDepth(uint(p.cfg.NameResolveDepth)))
+	if err != nil {
+		return nil, err
+	}
+	ttl := res.TTL
+	if ttl <= 0 {
+		ttl = defaultNameCacheTTL
+	}
+	p.nameCache.Add(key, nameCacheEntry{path: res.Path, eol: time.Now().Add(ttl)})
+	return path.Join(res.Path, segments[2:]...)
+}
+
+// republishKeystore lets the republisher see both the keys in the Peer's
+// keystore and those given to PublishName.
+type republishKeystore struct {
+	keystore.Keystore
+	published keystore.Keystore
+}
+
+func (ks *republishKeystore) List() ([]string, error) {
+	names, err := ks.Keystore.List()
+	if err != nil {
+		return nil, err
+	}
+	published, err := ks.published.List()
+	if err != nil {
+		return nil, err
+	}
+	return append(names, published...), nil
+}
+
+func (ks *republishKeystore) Get(name string) (crypto.PrivKey, error) {
+	priv, err := ks.published.Get(name)
+	if errors.Is(err, keystore.ErrNoSuchKey) {
+		return ks.Keystore.Get(name)
+	}
+	return priv, err
+}
@@ -0,0 +1,162 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ipfs/boxo/namesys"
+)
+
+func TestPublishResolveName(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	nd1, err := p.AddFile(ctx, bytes.NewReader([]byte("first")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd2, err := p.AddFile(ctx, bytes.NewReader([]byte("second")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := p.PublishName(ctx, key, "/ipfs/"+nd1.Cid().String(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pth, err := p.ResolveName(ctx, name.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth.String() != "/ipfs/"+nd1.Cid().String() {
+		t.Error("unexpected path:", pth)
+	}
+
+	// Updates are seen right away.
+	_, err = p.PublishName(ctx, key, "/ipfs/"+nd2.Cid().String(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pth, err = p.ResolveName(ctx, "/ipns/"+name.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth.String() != "/ipfs/"+nd2.Cid().String() {
+		t.Error("unexpected path:", pth)
+	}
+
+	// Names pointing to names are resolved recursively.
+	key2, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name2, err := p.PublishName(ctx, key2, name.AsPath().String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pth, err = p.ResolveName(ctx, name2.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth.String() != "/ipfs/"+nd2.Cid().String() {
+		t.Error("unexpected path:", pth)
+	}
+
+	_, err = p.PublishName(ctx, nil, "/ipfs/"+nd1.Cid().String(), 0)
+	if err == nil {
+		t.Error("offline peers have no host key to publish with")
+	}
+}
+
+type mockDNSResolver struct {
+	mu  sync.Mutex
+	txt map[string][]string
+}
+
+func (r *mockDNSResolver) set(name string, txt ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.txt[name] = txt
+}
+
+func (r *mockDNSResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	txt, ok := r.txt[strings.TrimSuffix(name, ".")]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return txt, nil
+}
+
+func TestDNSLink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rslv := &mockDNSResolver{txt: make(map[string][]string)}
+	cfg := &Config{Offline: true, DNSResolver: rslv, NameResolveDepth: 2}
+	p, err := New(ctx, NewInMemoryDatastore(), nil, nil, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("docs")
+	dir := fstest.MapFS{"index.txt": &fstest.MapFile{Data: content}}
+	root, err := p.AddDirectory(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := p.AddFile(ctx, bytes.NewReader([]byte("other")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rslv.set("_dnslink.docs.example.com", "dnslink=/ipns/b.example.com")
+	rslv.set("_dnslink.b.example.com", "dnslink=/ipfs/"+root.Cid().String())
+	rslv.set("_dnslink.loop.example.com", "dnslink=/ipns/loop.example.com")
+
+	rsc, err := p.GetFileByPath(ctx, "/ipns/docs.example.com/index.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsc.Close()
+	content2, err := io.ReadAll(rsc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, content2) {
+		t.Error("different content put and retrieved")
+	}
+
+	// Resolved names are cached.
+	rslv.set("_dnslink.docs.example.com", "dnslink=/ipfs/"+other.Cid().String())
+	pth, err := p.ResolveName(ctx, "docs.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth.String() != "/ipfs/"+root.Cid().String() {
+		t.Error("expected the cached path, got:", pth)
+	}
+
+	_, err = p.ResolveName(ctx, "loop.example.com")
+	if !errors.Is(err, namesys.ErrResolveRecursion) {
+		t.Error("expected ErrResolveRecursion, got:", err)
+	}
+	_, err = p.ResolveName(ctx, "missing.example.com")
+	if err == nil {
+		t.Error("expected an error resolving a domain without DNSLink")
+	}
+}
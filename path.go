@@ -0,0 +1,76 @@
+package ipfslite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/fetcher"
+	bsfetcher "github.com/ipfs/boxo/fetcher/impl/blockservice"
+	ufsio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/boxo/path/resolver"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-unixfsnode"
+	dagpb "github.com/ipld/go-codec-dagpb"
+)
+
+func (p *Peer) setupResolver() error {
+	p.resolver = resolver.NewBasicResolver(newFetcherFactory(p.bserv))
+	return nil
+}
+
+// newFetcherFactory returns a fetcher.Factory which understands UnixFS
+// (including HAMT directories), DAG-PB, DAG-CBOR and DAG-JSON.
+func newFetcherFactory(bserv blockservice.BlockService) fetcher.Factory {
+	fetcherCfg := bsfetcher.NewFetcherConfig(bserv)
+	fetcherCfg.PrototypeChooser = dagpb.AddSupportToChooser(bsfetcher.DefaultPrototypeChooser)
+	return fetcherCfg.WithReifier(unixfsnode.Reify)
+}
+
+// ResolvePath resolves a content path like /ipfs/<cid>/a/b/c.txt. Path
+// segments are resolved as entry names in UnixFS directories (including
+// HAMT-sharded ones) and as field names in DAG-CBOR and DAG-JSON nodes. It
+// returns the last node that could be reached by following links, along with
+// the remaining path segments, which point to a value inside that node.
+// Paths starting with an IPNS name or a DNSLink domain, like
+// /ipns/example.com/a/b, are supported too (see ResolveName).
+func (p *Peer) ResolvePath(ctx context.Context, fpath string) (ipld.Node, []string, error) {
+	pth, err := path.NewPath(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pth.Mutable() {
+		pth, err = p.ResolveName(ctx, pth.String())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	ipath, err := path.NewImmutablePath(pth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, remainder, err := p.resolver.ResolveToLastNode(ctx, ipath)
+	if err != nil {
+		return nil, nil, err
+	}
+	nd, err := p.Get(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nd, remainder, nil
+}
+
+// GetFileByPath returns a reader to the UnixFS file found at the given IPFS
+// content path. See ResolvePath.
+func (p *Peer) GetFileByPath(ctx context.Context, fpath string) (ufsio.ReadSeekCloser, error) {
+	nd, remainder, err := p.ResolvePath(ctx, fpath)
+	if err != nil {
+		return nil, err
+	}
+	if len(remainder) > 0 {
+		return nil, fmt.Errorf("%s does not resolve to a file", fpath)
+	}
+	return ufsio.NewDagReader(ctx, nd, p)
+}
@@ -0,0 +1,83 @@
+package ipfslite
+
+import (
+	"context"
+	"io"
+	"testing"
+	"testing/fstest"
+
+	cbor "github.com/ipfs/go-ipld-cbor"
+	ipld "github.com/ipfs/go-ipld-format"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+func TestResolvePath(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	fsys := fstest.MapFS{
+		"a/b/c.txt": {Data: []byte("c")},
+	}
+
+	for _, shard := range []bool{false, true} {
+		root, err := p.AddDirectory(ctx, fsys, &AddParams{Shard: shard})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rsc, err := p.GetFileByPath(ctx, "/ipfs/"+root.Cid().String()+"/a/b/c.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rsc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "c" {
+			t.Error("unexpected content:", string(content))
+		}
+
+		_, _, err = p.ResolvePath(ctx, "/ipfs/"+root.Cid().String()+"/a/nope")
+		if err == nil {
+			t.Error("expected an error resolving a missing entry")
+		}
+	}
+}
+
+func TestResolvePathCBOR(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	codec := uint64(multihash.SHA2_256)
+	leaf, err := cbor.WrapObject(map[string]string{"akey": "avalue"}, codec, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := cbor.WrapObject(map[string]any{
+		"child": leaf.Cid(),
+		"name":  "root",
+	}, codec, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.AddMany(ctx, []ipld.Node{leaf, root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, remainder, err := p.ResolvePath(ctx, "/ipfs/"+root.Cid().String()+"/child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid() != leaf.Cid() || len(remainder) != 0 {
+		t.Error("path should resolve to the leaf node")
+	}
+
+	nd, remainder, err = p.ResolvePath(ctx, "/ipfs/"+root.Cid().String()+"/child/akey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid() != leaf.Cid() || len(remainder) != 1 || remainder[0] != "akey" {
+		t.Error("path should resolve to the leaf node with a remainder:", remainder)
+	}
+}
@@ -0,0 +1,53 @@
+package ipfslite
+
+import (
+	"github.com/ipfs/boxo/peering"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func (p *Peer) setupPeering() error {
+	if p.cfg.Offline || p.host == nil {
+		return nil
+	}
+
+	ps := peering.NewPeeringService(p.host)
+	for _, pinfo := range p.cfg.Peering {
+		ps.AddPeer(pinfo)
+	}
+	err := ps.Start()
+	if err != nil {
+		return err
+	}
+	p.peering = ps
+	return nil
+}
+
+// AddPeer adds a peer to the set of peers that the Peer stays connected to.
+// Connections to these peers are protected in the host's connection manager
+// and re-established with exponential backoff when they drop. Calling AddPeer
+// for an existing peer updates its addresses.
+func (p *Peer) AddPeer(pinfo peer.AddrInfo) error {
+	if p.peering == nil {
+		return ErrOffline
+	}
+	p.peering.AddPeer(pinfo)
+	return nil
+}
+
+// RemovePeer removes a peer added with AddPeer or Config.Peering. The
+// connection to it is not closed, but it is no longer protected.
+func (p *Peer) RemovePeer(pid peer.ID) error {
+	if p.peering == nil {
+		return ErrOffline
+	}
+	p.peering.RemovePeer(pid)
+	return nil
+}
+
+// ListPeers returns the peers that the Peer stays connected to.
+func (p *Peer) ListPeers() []peer.AddrInfo {
+	if p.peering == nil {
+		return nil
+	}
+	return p.peering.ListPeers()
+}
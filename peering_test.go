@@ -0,0 +1,77 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/boxo/peering"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+)
+
+func TestPeering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm, err := connmgr.NewConnManager(10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1, err := libp2p.New(libp2p.NoListenAddrs, libp2p.ConnectionManager(cm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	h3, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h3.Close()
+
+	cfg := &Config{
+		ReprovideInterval: -1,
+		Peering:           []peer.AddrInfo{{ID: h2.ID(), Addrs: h2.Addrs()}},
+	}
+	p, err := New(ctx, NewInMemoryDatastore(), nil, h1, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	err = p.AddPeer(peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.ListPeers()); n != 2 {
+		t.Fatalf("expected 2 peering peers, got %d", n)
+	}
+	for _, pid := range []peer.ID{h2.ID(), h3.ID()} {
+		if !cm.IsProtected(pid, peering.ConnmgrTag) {
+			t.Errorf("%s should be protected", pid)
+		}
+	}
+
+	err = p.RemovePeer(h2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := p.ListPeers()
+	if len(peers) != 1 || peers[0].ID != h3.ID() {
+		t.Error("unexpected peering peers:", peers)
+	}
+	if cm.IsProtected(h2.ID(), peering.ConnmgrTag) {
+		t.Error("removed peer should not be protected")
+	}
+
+	err = setupOfflinePeer(t).AddPeer(peer.AddrInfo{ID: h2.ID()})
+	if !errors.Is(err, ErrOffline) {
+		t.Error("expected ErrOffline")
+	}
+}
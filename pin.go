@@ -0,0 +1,91 @@
+package ipfslite
+
+import (
+	"context"
+
+	ipfspinner "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/boxo/pinning/pinner/dspinner"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+)
+
+var pinnerDatastorePrefix = datastore.NewKey("pinner")
+
+func (p *Peer) setupPinner() error {
+	pinner, err := dspinner.New(p.ctx, namespace.Wrap(p.store, pinnerDatastorePrefix), p)
+	if err != nil {
+		return err
+	}
+	p.pinner = pinner
+	return nil
+}
+
+// Pin marks the given CID so that it is kept by the Peer. Recursive pins
+// protect the full DAG below the CID, which is fetched if not available
+// locally. Direct pins only protect the given block. Pins are persisted in
+// the Peer's datastore.
+func (p *Peer) Pin(ctx context.Context, c cid.Cid, recursive bool) error {
+	defer p.bstore.PinLock(ctx).Unlock(ctx)
+	return p.pin(ctx, c, recursive)
+}
+
+func (p *Peer) pin(ctx context.Context, c cid.Cid, recursive bool) error {
+	nd, err := p.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	return p.pinner.Pin(ctx, nd, recursive, "")
+}
+
+// Unpin removes the pin for the given CID. If recursive is false, only a
+// direct pin is removed. Otherwise, either a recursive or a direct pin is
+// removed.
+func (p *Peer) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	err := p.pinner.Unpin(ctx, c, recursive)
+	if err == nil && p.quota != nil {
+		p.quota.pinsRemoved()
+	}
+	return err
+}
+
+// IsPinned returns whether the given CID is pinned, along with the reason: a
+// "recursive" or "direct" pin, or an indirect pin via another CID which is
+// pinned recursively.
+func (p *Peer) IsPinned(ctx context.Context, c cid.Cid) (string, bool, error) {
+	return p.pinner.IsPinned(ctx, c)
+}
+
+// ListPins returns all the recursive and direct pins.
+func (p *Peer) ListPins(ctx context.Context) ([]ipfspinner.Pinned, error) {
+	recursive, err := collectPins(p.pinner.RecursiveKeys(ctx, false), ipfspinner.Recursive)
+	if err != nil {
+		return nil, err
+	}
+	direct, err := collectPins(p.pinner.DirectKeys(ctx, false), ipfspinner.Direct)
+	if err != nil {
+		return nil, err
+	}
+	return append(recursive, direct...), nil
+}
+
+func collectPins(ch <-chan ipfspinner.StreamedPin, mode ipfspinner.Mode) ([]ipfspinner.Pinned, error) {
+	var pins []ipfspinner.Pinned
+	var err error
+	for sp := range ch {
+		// Keep draining so that the streaming goroutine can finish.
+		if sp.Err != nil {
+			err = sp.Err
+			continue
+		}
+		// The pinner does not set the mode when streaming.
+		sp.Pin.Mode = mode
+		pins = append(pins, sp.Pin)
+	}
+	return pins, err
+}
+
+// Pinner offers access to the pinner used by the Peer.
+func (p *Peer) Pinner() ipfspinner.Pinner {
+	return p.pinner
+}
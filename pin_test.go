@@ -0,0 +1,106 @@
+package ipfslite
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	ipfspinner "github.com/ipfs/boxo/pinning/pinner"
+)
+
+func TestPinning(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+
+	fsys := fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"b.txt": {Data: []byte("b")},
+	}
+	root, err := p.AddDirectory(ctx, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := root.Links()[0].Cid
+
+	err = p.Pin(ctx, root.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Pin(ctx, child, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason, pinned, err := p.IsPinned(ctx, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned || reason != "recursive" {
+		t.Error("root should be pinned recursively:", reason)
+	}
+
+	_, pinned, err = p.IsPinned(ctx, root.Links()[1].Cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned {
+		t.Error("child should be pinned indirectly")
+	}
+
+	pins, err := p.ListPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("expected 2 pins, got %d", len(pins))
+	}
+	if pins[0].Key != root.Cid() || pins[0].Mode != ipfspinner.Recursive {
+		t.Error("expected a recursive pin for the root")
+	}
+	if pins[1].Key != child || pins[1].Mode != ipfspinner.Direct {
+		t.Error("expected a direct pin for the child")
+	}
+
+	err = p.Unpin(ctx, root.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pinned, err = p.IsPinned(ctx, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned {
+		t.Error("root should not be pinned anymore")
+	}
+}
+
+func TestPinningPersisted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := NewInMemoryDatastore()
+	p1, err := New(ctx, ds, nil, nil, nil, &Config{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := p1.AddDirectory(ctx, fstest.MapFS{"a.txt": {Data: []byte("a")}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p1.Pin(ctx, root.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := New(ctx, ds, nil, nil, nil, &Config{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pinned, err := p2.IsPinned(ctx, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned {
+		t.Error("pin should have been loaded from the datastore")
+	}
+}
@@ -0,0 +1,393 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/pinning/pinner/dspinner"
+	provider "github.com/ipfs/boxo/provider"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// ErrOffline is returned when performing operations that require network
+// access on an offline Peer.
+var ErrOffline = errors.New("the peer is offline")
+
+// Reprovide strategies for Config.ReprovideStrategy.
+const (
+	// ReprovideAll reprovides every block in the blockstore, including
+	// those that were only fetched from other peers.
+	ReprovideAll = "all"
+	// ReprovidePinned reprovides every block in pinned DAGs.
+	ReprovidePinned = "pinned"
+	// ReprovideRoots only reprovides the roots of the DAGs added to the
+	// Peer (with AddFile, AddDirectory, AddPath or ImportCAR) and of
+	// pinned DAGs. Added roots are only recorded while this strategy is
+	// in use.
+	ReprovideRoots = "roots"
+)
+
+// addedRootsDatastorePrefix namespaces the roots of added DAGs, which are
+// reprovided by the ReprovideRoots strategy.
+var addedRootsDatastorePrefix = datastore.NewKey("roots")
+
+func (p *Peer) reprovideKeyProvider() (provider.KeyChanFunc, error) {
+	switch p.cfg.ReprovideStrategy {
+	case ReprovideAll:
+		return p.bstore.AllKeysChan, nil
+	case ReprovidePinned:
+		// Walk pinned DAGs using local blocks only.
+		return provider.NewBufferedProvider(
+			dspinner.NewPinnedProvider(false, p.pinner, newFetcherFactory(p.localBlockService())),
+		), nil
+	case ReprovideRoots:
+		return provider.NewPrioritizedProvider(
+			p.addedRootsProvider,
+			provider.NewBufferedProvider(
+				dspinner.NewPinnedProvider(true, p.pinner, newFetcherFactory(p.localBlockService())),
+			),
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown reprovide strategy: %s", p.cfg.ReprovideStrategy)
+	}
+}
+
+// recordRoots remembers the roots of added DAGs when using the
+// ReprovideRoots strategy.
+func (p *Peer) recordRoots(ctx context.Context, cids ...cid.Cid) error {
+	if p.cfg.ReprovideStrategy != ReprovideRoots {
+		return nil
+	}
+	ds := namespace.Wrap(p.store, addedRootsDatastorePrefix)
+	for _, c := range cids {
+		err := ds.Put(ctx, datastore.NewKey(c.String()), nil)
+		if err != nil {
+			return fmt.Errorf("recording root %s: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// addedRootsProvider streams the recorded roots of added DAGs. Roots which
+// are no longer in the blockstore (i.e. removed or garbage-collected) are
+// forgotten.
+func (p *Peer) addedRootsProvider(ctx context.Context) (<-chan cid.Cid, error) {
+	ds := namespace.Wrap(p.store, addedRootsDatastorePrefix)
+	res, err := ds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		//nolint:errcheck
+		defer res.Close()
+		for r := range res.Next() {
+			if r.Error != nil {
+				logger.Errorf("listing added roots: %s", r.Error)
+				return
+			}
+			c, err := cid.Decode(datastore.NewKey(r.Key).BaseNamespace())
+			if err != nil {
+				logger.Warnf("bad added root %s: %s", r.Key, err)
+				continue
+			}
+			has, err := p.bstore.Has(ctx, c)
+			if err != nil {
+				logger.Errorf("checking added root %s: %s", c, err)
+				continue
+			}
+			if !has {
+				err = ds.Delete(ctx, datastore.NewKey(r.Key))
+				if err != nil {
+					logger.Errorf("forgetting added root %s: %s", c, err)
+				}
+				continue
+			}
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Provide queues the given CID to be announced to the network right away,
+// rather than waiting for the next reprovide run. When recursive is set, all
+// the blocks in the DAG below it are announced too, as long as they are
+// available locally: missing blocks, and anything below them, are skipped
+// without error. Nothing is announced when the Peer is offline or
+// reproviding is disabled.
+func (p *Peer) Provide(ctx context.Context, c cid.Cid, recursive bool) error {
+	if !recursive {
+		return p.reprovider.Provide(ctx, c, true)
+	}
+
+	var provideErr error
+	visited := cid.NewSet()
+	visit := func(c cid.Cid) bool {
+		if provideErr != nil || !visited.Visit(c) {
+			return false
+		}
+		// Skip blocks which are not available locally, along with
+		// the DAGs below them.
+		has, err := p.bstore.Has(ctx, c)
+		if err != nil {
+			provideErr = err
+			return false
+		}
+		if !has {
+			return false
+		}
+		provideErr = p.reprovider.Provide(ctx, c, true)
+		return provideErr == nil
+	}
+	getLinks := merkledag.GetLinksWithDAG(merkledag.NewDAGService(p.localBlockService()))
+	err := merkledag.Walk(ctx, getLinks, c, visit)
+	if err != nil {
+		return err
+	}
+	return provideErr
+}
+
+// provideOnAdd provides the given CIDs when Config.ProvideOnAdd is set.
+// Errors are only logged, as the content has been added regardless.
+func (p *Peer) provideOnAdd(ctx context.Context, cids ...cid.Cid) {
+	if !p.cfg.ProvideOnAdd {
+		return
+	}
+	for _, c := range cids {
+		err := p.reprovider.Provide(ctx, c, true)
+		if err != nil {
+			logger.Warnf("providing %s: %s", c, err)
+		}
+	}
+}
+
+// providingDAGService provides every node added through it when
+// Config.ProvideOnAdd is set.
+type providingDAGService struct {
+	ipld.DAGService
+	peer *Peer
+}
+
+func (dag *providingDAGService) Add(ctx context.Context, nd ipld.Node) error {
+	err := dag.DAGService.Add(ctx, nd)
+	if err != nil {
+		return err
+	}
+	dag.peer.provideOnAdd(ctx, nd.Cid())
+	return nil
+}
+
+func (dag *providingDAGService) AddMany(ctx context.Context, nds []ipld.Node) error {
+	err := dag.DAGService.AddMany(ctx, nds)
+	if err != nil {
+		return err
+	}
+	for _, nd := range nds {
+		dag.peer.provideOnAdd(ctx, nd.Cid())
+	}
+	return nil
+}
+
+// FindProviders looks up peers providing the given CID using the configured
+// routing. It returns once limit providers have been found (0 means no
+// limit), the lookup finishes or the context is cancelled, along with the
+// providers found so far.
+func (p *Peer) FindProviders(ctx context.Context, c cid.Cid, limit int) ([]peer.AddrInfo, error) {
+	if p.cfg.Offline || p.dht == nil {
+		return nil, ErrOffline
+	}
+
+	var provs []peer.AddrInfo
+	for pinfo := range p.dht.FindProvidersAsync(ctx, c, limit) {
+		provs = append(provs, pinfo)
+	}
+	return provs, nil
+}
+
+// ProvideStats reports on the announcements made by the Peer.
+type ProvideStats struct {
+	// LastReprovide is the time when the last reprovide run finished.
+	LastReprovide time.Time
+	// LastReprovideBatchSize is the number of keys announced during the
+	// last reprovide run.
+	LastReprovideBatchSize uint64
+	// TotalReprovides is the number of keys announced by all reprovide
+	// runs.
+	TotalReprovides uint64
+	// Provided is the number of successful announcements, including
+	// reprovides.
+	Provided uint64
+	// Failed is the number of failed announcements, including reprovides.
+	Failed uint64
+	// QueueLength is the number of CIDs waiting to be announced after
+	// calls to Provide or additions with Config.ProvideOnAdd.
+	QueueLength int
+}
+
+// ProvideStats returns statistics about content announcements since the Peer
+// was created. All values are zero for offline peers or when reproviding is
+// disabled.
+func (p *Peer) ProvideStats() (ProvideStats, error) {
+	if p.provideStats == nil {
+		return ProvideStats{}, nil
+	}
+
+	st, err := p.reprovider.Stat()
+	if err != nil {
+		return ProvideStats{}, err
+	}
+	return ProvideStats{
+		LastReprovide:          st.LastRun,
+		LastReprovideBatchSize: st.LastReprovideBatchSize,
+		TotalReprovides:        st.TotalReprovides,
+		Provided:               p.provideStats.provided.Load(),
+		Failed:                 p.provideStats.failed.Load(),
+		QueueLength:            p.provideStats.queueLength(),
+	}, nil
+}
+
+// provideTracker counts announcements by wrapping the routing used by the
+// provider.System, and queued CIDs by wrapping the provider.System itself.
+type provideTracker struct {
+	provided atomic.Uint64
+	failed   atomic.Uint64
+
+	mu      sync.Mutex
+	pending map[string]int // by multihash
+	queued  int
+}
+
+func newProvideTracker() *provideTracker {
+	return &provideTracker{
+		pending: make(map[string]int),
+	}
+}
+
+func (pt *provideTracker) queueLength() int {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.queued
+}
+
+func (pt *provideTracker) enqueue(c cid.Cid) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.pending[string(c.Hash())]++
+	pt.queued++
+}
+
+func (pt *provideTracker) dequeue(c cid.Cid) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	key := string(c.Hash())
+	n, ok := pt.pending[key]
+	if !ok {
+		return
+	}
+	if n <= 1 {
+		delete(pt.pending, key)
+	} else {
+		pt.pending[key] = n - 1
+	}
+	pt.queued--
+}
+
+func (pt *provideTracker) wrapRouting(rsys provider.Provide) provider.Provide {
+	tr := &trackingRouting{rsys: rsys, tracker: pt}
+	if many, ok := rsys.(provider.ProvideMany); ok {
+		return &trackingManyRouting{trackingRouting: tr, many: many}
+	}
+	return tr
+}
+
+func (pt *provideTracker) wrapSystem(sys provider.System) provider.System {
+	return &trackingSystem{System: sys, tracker: pt}
+}
+
+type trackingRouting struct {
+	rsys    provider.Provide
+	tracker *provideTracker
+}
+
+func (tr *trackingRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	err := tr.rsys.Provide(ctx, c, announce)
+	// Reprovides are also counted as dequeued, as the CID is announced
+	// either way.
+	tr.tracker.dequeue(c)
+	if err != nil {
+		tr.tracker.failed.Add(1)
+		return err
+	}
+	tr.tracker.provided.Add(1)
+	return nil
+}
+
+// trackingManyRouting preserves the provider.ProvideMany and provider.Ready
+// interfaces of routings supporting them.
+type trackingManyRouting struct {
+	*trackingRouting
+	many provider.ProvideMany
+}
+
+func (tr *trackingManyRouting) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	err := tr.many.ProvideMany(ctx, keys)
+	for _, k := range keys {
+		tr.tracker.dequeue(cid.NewCidV1(cid.Raw, k))
+	}
+	if err != nil {
+		tr.tracker.failed.Add(uint64(len(keys)))
+		return err
+	}
+	tr.tracker.provided.Add(uint64(len(keys)))
+	return nil
+}
+
+func (tr *trackingManyRouting) Ready() bool {
+	if r, ok := tr.many.(provider.Ready); ok {
+		return r.Ready()
+	}
+	return true
+}
+
+type trackingSystem struct {
+	provider.System
+	tracker *provideTracker
+}
+
+func (ts *trackingSystem) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	// Enqueue first, as the CID may be announced (and dequeued) before
+	// System.Provide returns.
+	ts.tracker.enqueue(c)
+	err := ts.System.Provide(ctx, c, announce)
+	if err != nil {
+		ts.tracker.dequeue(c)
+		return err
+	}
+	return nil
+}
+
+func (ts *trackingSystem) Clear() int {
+	n := ts.System.Clear()
+	ts.tracker.mu.Lock()
+	defer ts.tracker.mu.Unlock()
+	ts.tracker.pending = make(map[string]int)
+	ts.tracker.queued = 0
+	return n
+}
@@ -0,0 +1,355 @@
+package ipfslite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	provider "github.com/ipfs/boxo/provider"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+func TestReprovideStrategies(t *testing.T) {
+	ctx := context.Background()
+	p := setupOfflinePeer(t)
+	// Added roots are only recorded with the roots strategy.
+	p.cfg.ReprovideStrategy = ReprovideRoots
+
+	pinned, err := p.AddDirectory(ctx, fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"b.txt": {Data: []byte("b")},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Pin(ctx, pinned.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notPinned, err := p.AddFile(ctx, bytes.NewReader([]byte("not pinned")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reprovided := func(strategy string) *cid.Set {
+		p.cfg.ReprovideStrategy = strategy
+		kp, err := p.reprovideKeyProvider()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, err := kp(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := cid.NewSet()
+		for c := range ch {
+			keys.Add(c)
+		}
+		return keys
+	}
+
+	for strategy, expected := range map[string]int{
+		ReprovideAll:    4,
+		ReprovidePinned: 3,
+		ReprovideRoots:  2,
+	} {
+		keys := reprovided(strategy)
+		if keys.Len() != expected {
+			t.Errorf("%s: expected %d keys, got %d", strategy, expected, keys.Len())
+		}
+		if strategy == ReprovideRoots && (!keys.Has(pinned.Cid()) || !keys.Has(notPinned.Cid())) {
+			t.Error("roots strategy should provide the roots of added DAGs")
+		}
+	}
+
+	// Removed roots are no longer reprovided.
+	err = p.Remove(ctx, notPinned.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := reprovided(ReprovideRoots); keys.Len() != 1 || !keys.Has(pinned.Cid()) {
+		t.Errorf("expected only the pinned root, got %v", keys.Keys())
+	}
+	rootsDs := namespace.Wrap(p.store, addedRootsDatastorePrefix)
+	if has, _ := rootsDs.Has(ctx, datastore.NewKey(notPinned.Cid().String())); has {
+		t.Error("removed root should have been forgotten")
+	}
+
+	// Other strategies do not record roots.
+	p.cfg.ReprovideStrategy = ReprovideAll
+	other, err := p.AddFile(ctx, bytes.NewReader([]byte("other")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := rootsDs.Has(ctx, datastore.NewKey(other.Cid().String())); has {
+		t.Error("roots should not be recorded with the all strategy")
+	}
+
+	p.cfg.ReprovideStrategy = "nope"
+	_, err = p.reprovideKeyProvider()
+	if err == nil {
+		t.Error("expected an error with an unknown strategy")
+	}
+}
+
+type mockProvider struct {
+	provider.System
+	provided []cid.Cid
+}
+
+func (mp *mockProvider) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	mp.provided = append(mp.provided, c)
+	return nil
+}
+
+func TestProvideOnAdd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := New(ctx, NewInMemoryDatastore(), nil, nil, nil, &Config{
+		Offline:      true,
+		ProvideOnAdd: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := &mockProvider{System: p.reprovider}
+	p.reprovider = mp
+
+	nd, err := p.AddFile(ctx, bytes.NewReader([]byte("hola")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := p.AddDirectory(ctx, fstest.MapFS{"a.txt": {Data: []byte("a")}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Add(ctx, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []cid.Cid{nd.Cid(), dir.Cid(), nd.Cid()}
+	if len(mp.provided) != len(expected) {
+		t.Fatalf("expected %d provides, got %d", len(expected), len(mp.provided))
+	}
+	for i, c := range expected {
+		if mp.provided[i] != c {
+			t.Errorf("provide %d: expected %s, got %s", i, c, mp.provided[i])
+		}
+	}
+
+	mp.provided = nil
+	err = p.Provide(ctx, dir.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.provided) != 2 {
+		t.Errorf("expected the directory and its file to be provided: %v", mp.provided)
+	}
+
+	// Blocks missing locally are skipped.
+	partial, err := p.AddDirectory(ctx, fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"b.txt": {Data: []byte("b")},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := partial.Links()[1].Cid
+	err = p.Remove(ctx, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp.provided = nil
+	err = p.Provide(ctx, partial.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.provided) != 2 {
+		t.Errorf("expected the directory and its local file to be provided: %v", mp.provided)
+	}
+	for _, c := range mp.provided {
+		if c.Equals(missing) {
+			t.Error("missing block should not be provided")
+		}
+	}
+}
+
+type mockRouting struct {
+	routing.Routing
+	provs []peer.AddrInfo
+}
+
+func (mr *mockRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	if c.Prefix().Codec == cid.Raw {
+		return errors.New("raw blocks are not provided by this mock")
+	}
+	return nil
+}
+
+func (mr *mockRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, limit int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo, len(mr.provs))
+	for _, pinfo := range mr.provs {
+		ch <- pinfo
+	}
+	close(ch)
+	return ch
+}
+
+func TestProvideStatsAndFindProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	mr := &mockRouting{provs: []peer.AddrInfo{{ID: h.ID()}}}
+	p, err := New(ctx, NewInMemoryDatastore(), nil, h, mr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := p.AddFile(ctx, bytes.NewReader([]byte("find me")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := p.AddFile(ctx, bytes.NewReader([]byte("raw")), &AddParams{RawLeaves: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cid.Cid{nd.Cid(), raw.Cid()} {
+		err = p.Provide(ctx, c, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		st, err := p.ProvideStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.QueueLength == 0 {
+			if st.Provided != 1 || st.Failed != 1 {
+				t.Errorf("unexpected stats: %+v", st)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("content was not provided: %+v", st)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	provs, err := p.FindProviders(ctx, nd.Cid(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) != 1 || provs[0].ID != h.ID() {
+		t.Error("unexpected providers:", provs)
+	}
+
+	_, err = setupOfflinePeer(t).FindProviders(ctx, nd.Cid(), 1)
+	if !errors.Is(err, ErrOffline) {
+		t.Error("expected ErrOffline")
+	}
+}
+
+// syncProvider announces CIDs before Provide returns, as a provider.System
+// worker may do.
+type syncProvider struct {
+	provider.System
+	rsys provider.Provide
+	err  error
+}
+
+func (sp *syncProvider) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	if sp.err != nil {
+		return sp.err
+	}
+	return sp.rsys.Provide(ctx, c, announce)
+}
+
+func TestProvideTrackerQueue(t *testing.T) {
+	ctx := context.Background()
+	pt := newProvideTracker()
+	sp := &syncProvider{rsys: pt.wrapRouting(&mockRouting{})}
+	sys := pt.wrapSystem(sp)
+
+	nd, err := setupOfflinePeer(t).AddFile(ctx, bytes.NewReader([]byte("queued")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sys.Provide(ctx, nd.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := pt.queueLength(); n != 0 {
+		t.Errorf("expected an empty queue, got %d", n)
+	}
+
+	sp.err = errors.New("queue failure")
+	err = sys.Provide(ctx, nd.Cid(), true)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := pt.queueLength(); n != 0 {
+		t.Errorf("expected an empty queue after a failure, got %d", n)
+	}
+}
+
+func TestProvideWithoutRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// An online Peer without routing, with reproviding enabled.
+	p, err := New(ctx, NewInMemoryDatastore(), nil, h, nil, &Config{
+		ProvideOnAdd:      true,
+		ReprovideInterval: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := p.AddFile(ctx, bytes.NewReader([]byte("nowhere to provide")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Provide(ctx, nd.Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Give the provider workers and a reprovide run a chance to start.
+	time.Sleep(300 * time.Millisecond)
+
+	st, err := p.ProvideStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Provided != 0 || st.Failed != 0 {
+		t.Errorf("nothing should have been announced: %+v", st)
+	}
+	err = p.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
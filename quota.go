@@ -0,0 +1,302 @@
+package ipfslite
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	blockstore "github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// ErrQuotaExceeded is returned when writing to the blockstore would exceed
+// Config.MaxBlockstoreSize and Config.RefuseWritesOverQuota is set.
+var ErrQuotaExceeded = errors.New("blockstore quota exceeded")
+
+// When evicting, blocks are removed until the blockstore is below this
+// fraction of the quota, so that evictions do not run on every write.
+var quotaEvictionTarget = 0.9
+
+// quotaBlockstore keeps track of the size of the blocks in the wrapped
+// blockstore and the order in which they were last accessed. When the quota
+// is exceeded, it either refuses writes or signals that blocks should be
+// evicted, which is done by Peer.evict.
+type quotaBlockstore struct {
+	blockstore.Blockstore
+
+	max    uint64
+	refuse bool
+
+	mu       sync.Mutex
+	used     uint64
+	inflight uint64     // reserved by ongoing writes
+	lru      *list.List // front is the most recently used
+	entries  map[string]*list.Element
+	// pinnedFloor is the usage left by the last eviction that could not
+	// get below the quota because of pinned content, or 0.
+	pinnedFloor uint64
+
+	evictCh chan struct{}
+}
+
+type quotaEntry struct {
+	c    cid.Cid
+	size uint64
+}
+
+func newQuotaBlockstore(ctx context.Context, bs blockstore.Blockstore, max uint64, refuse bool) (*quotaBlockstore, error) {
+	qbs := &quotaBlockstore{
+		Blockstore: bs,
+		max:        max,
+		refuse:     refuse,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		evictCh:    make(chan struct{}, 1),
+	}
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for c := range keys {
+		size, err := bs.GetSize(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		qbs.entries[string(c.Hash())] = qbs.lru.PushBack(&quotaEntry{c: c, size: uint64(size)})
+		qbs.used += uint64(size)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	qbs.signalEviction()
+	return qbs, nil
+}
+
+// signalEviction triggers an eviction when over quota. When pinned content
+// alone was over quota in the last eviction, it waits until enough new
+// content has been written, rather than walking all pins on every write.
+// It must be called with the lock held, or before the quotaBlockstore is
+// in use.
+func (qbs *quotaBlockstore) signalEviction() {
+	if qbs.refuse || qbs.used <= qbs.max {
+		return
+	}
+	slack := qbs.max - uint64(float64(qbs.max)*quotaEvictionTarget)
+	if qbs.pinnedFloor > 0 && qbs.used < qbs.pinnedFloor+slack {
+		return
+	}
+	select {
+	case qbs.evictCh <- struct{}{}:
+	default:
+	}
+}
+
+func (qbs *quotaBlockstore) touch(c cid.Cid) {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+	if elem, ok := qbs.entries[string(c.Hash())]; ok {
+		qbs.lru.MoveToFront(elem)
+	}
+}
+
+// reserve accounts for the given blocks before they are written, refusing
+// them when they do not fit in the quota. It returns the blocks that are not
+// stored yet and their size, which must be passed to commit once writing
+// finishes.
+func (qbs *quotaBlockstore) reserve(blks []blocks.Block) ([]blocks.Block, uint64, error) {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+
+	var size uint64
+	newBlks := make([]blocks.Block, 0, len(blks))
+	for _, blk := range blks {
+		c := blk.Cid()
+		if c.Prefix().MhType == multihash.IDENTITY {
+			continue
+		}
+		if elem, ok := qbs.entries[string(c.Hash())]; ok {
+			qbs.lru.MoveToFront(elem)
+			continue
+		}
+		newBlks = append(newBlks, blk)
+		size += uint64(len(blk.RawData()))
+	}
+
+	if qbs.refuse && qbs.used+qbs.inflight+size > qbs.max {
+		return nil, 0, ErrQuotaExceeded
+	}
+	qbs.inflight += size
+	return newBlks, size, nil
+}
+
+// commit releases a reservation and, if writing succeeded, records the
+// written blocks as stored.
+func (qbs *quotaBlockstore) commit(blks []blocks.Block, size uint64, written bool) {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+
+	qbs.inflight -= size
+	if !written {
+		return
+	}
+	for _, blk := range blks {
+		key := string(blk.Cid().Hash())
+		if _, ok := qbs.entries[key]; ok { // duplicated or written concurrently
+			continue
+		}
+		entry := &quotaEntry{c: blk.Cid(), size: uint64(len(blk.RawData()))}
+		qbs.entries[key] = qbs.lru.PushFront(entry)
+		qbs.used += entry.size
+	}
+	qbs.signalEviction()
+}
+
+func (qbs *quotaBlockstore) release(c cid.Cid) {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+
+	key := string(c.Hash())
+	elem, ok := qbs.entries[key]
+	if !ok {
+		return
+	}
+	qbs.used -= elem.Value.(*quotaEntry).size
+	qbs.lru.Remove(elem)
+	delete(qbs.entries, key)
+	qbs.pinnedFloor = min(qbs.pinnedFloor, qbs.used)
+}
+
+// Put and PutMany always write through, even when the blocks are known to
+// be stored, so that they never report success for a block that another
+// ongoing write may still fail to store.
+func (qbs *quotaBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	newBlks, size, err := qbs.reserve([]blocks.Block{blk})
+	if err != nil {
+		return err
+	}
+	err = qbs.Blockstore.Put(ctx, blk)
+	qbs.commit(newBlks, size, err == nil)
+	return err
+}
+
+func (qbs *quotaBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	newBlks, size, err := qbs.reserve(blks)
+	if err != nil {
+		return err
+	}
+	err = qbs.Blockstore.PutMany(ctx, blks)
+	qbs.commit(newBlks, size, err == nil)
+	return err
+}
+
+func (qbs *quotaBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := qbs.Blockstore.Get(ctx, c)
+	if err == nil {
+		qbs.touch(c)
+	}
+	return blk, err
+}
+
+func (qbs *quotaBlockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	err := qbs.Blockstore.DeleteBlock(ctx, c)
+	if err == nil {
+		qbs.release(c)
+	}
+	return err
+}
+
+// usage returns the number of bytes used by the blocks in the blockstore.
+func (qbs *quotaBlockstore) usage() uint64 {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+	return qbs.used
+}
+
+// setPinnedFloor records the usage left after an eviction run, or clears
+// it when the run got below the quota.
+func (qbs *quotaBlockstore) setPinnedFloor() {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+	if qbs.used > qbs.max {
+		qbs.pinnedFloor = qbs.used
+	} else {
+		qbs.pinnedFloor = 0
+	}
+}
+
+// pinsRemoved allows eviction to run again right away, as content that
+// was pinned may be evictable now.
+func (qbs *quotaBlockstore) pinsRemoved() {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+	qbs.pinnedFloor = 0
+	qbs.signalEviction()
+}
+
+// evictionCandidates returns the stored CIDs, least recently used first.
+func (qbs *quotaBlockstore) evictionCandidates() []cid.Cid {
+	qbs.mu.Lock()
+	defer qbs.mu.Unlock()
+
+	cids := make([]cid.Cid, 0, qbs.lru.Len())
+	for elem := qbs.lru.Back(); elem != nil; elem = elem.Prev() {
+		cids = append(cids, elem.Value.(*quotaEntry).c)
+	}
+	return cids
+}
+
+func (p *Peer) evictLoop() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-p.quota.evictCh:
+			err := p.evict(p.ctx)
+			if err != nil && p.ctx.Err() == nil {
+				logger.Errorf("evicting blocks: %s", err)
+			}
+		}
+	}
+}
+
+// evict removes blocks that are not pinned, least recently used first,
+// until the blockstore is below quotaEvictionTarget of the quota. Like GC, it
+// waits for ongoing additions to finish.
+func (p *Peer) evict(ctx context.Context) error {
+	defer p.bstore.GCLock(ctx).Unlock(ctx)
+
+	target := uint64(float64(p.quota.max) * quotaEvictionTarget)
+	if p.quota.usage() <= p.quota.max {
+		return nil
+	}
+
+	marked, err := p.markPinned(ctx)
+	if err != nil {
+		return err
+	}
+
+	evicted := 0
+	for _, c := range p.quota.evictionCandidates() {
+		if p.quota.usage() <= target {
+			break
+		}
+		if marked.Has(gcKey(c)) {
+			continue
+		}
+		err := p.bstore.DeleteBlock(ctx, c)
+		if err != nil {
+			return err
+		}
+		evicted++
+	}
+	logger.Debugf("evicted %d blocks", evicted)
+	p.quota.setPinnedFloor()
+	if used := p.quota.usage(); used > p.quota.max {
+		logger.Warnf("blockstore is over quota (%d/%d bytes) with pinned content", used, p.quota.max)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package ipfslite
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	blockstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+func setupQuotaPeer(t *testing.T, cfg *Config) *Peer {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg.Offline = true
+	p, err := New(ctx, NewInMemoryDatastore(), nil, nil, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newRawBlock(t *testing.T, data []byte) blocks.Block {
+	h, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk, err := blocks.NewBlockWithCid(data, cid.NewCidV1(cid.Raw, h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blk
+}
+
+func TestQuotaEviction(t *testing.T) {
+	ctx := context.Background()
+	p := setupQuotaPeer(t, &Config{MaxBlockstoreSize: 1000})
+
+	// The first block is a 100-byte dag-pb node, so that pinning it
+	// recursively walks it.
+	pinned := merkledag.NodeWithData(make([]byte, 98))
+	if len(pinned.RawData()) != 100 {
+		t.Fatalf("unexpected node size %d", len(pinned.RawData()))
+	}
+	blks := []blocks.Block{pinned}
+	for i := 1; i < 10; i++ {
+		data := make([]byte, 100)
+		data[0] = byte(i)
+		blks = append(blks, newRawBlock(t, data))
+	}
+
+	err := p.BlockStore().PutMany(ctx, blks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pin the first block and then access all the others, so that the
+	// pinned block is the least recently used one.
+	err = p.Pin(ctx, blks[0].Cid(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blk := range blks[1:] {
+		_, err = p.BlockStore().Get(ctx, blk.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lru := p.quota.evictionCandidates()[0]; !lru.Equals(blks[0].Cid()) {
+		t.Fatalf("expected the pinned block to be the least recently used, got %s", lru)
+	}
+
+	if used := p.quota.usage(); used != 1000 {
+		t.Fatalf("expected 1000 bytes used, got %d", used)
+	}
+
+	data := make([]byte, 100)
+	data[0] = 100
+	extra := newRawBlock(t, data)
+	err = p.BlockStore().Put(ctx, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.quota.usage() > 900 {
+		if time.Now().After(deadline) {
+			t.Fatal("blocks were not evicted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, c := range []blocks.Block{blks[0], blks[3], extra} {
+		if ok, _ := p.HasBlock(ctx, c.Cid()); !ok {
+			t.Errorf("block %s should not have been evicted", c.Cid())
+		}
+	}
+	for _, c := range []blocks.Block{blks[1], blks[2]} {
+		if ok, _ := p.HasBlock(ctx, c.Cid()); ok {
+			t.Errorf("least recently used block %s should have been evicted", c.Cid())
+		}
+	}
+	// Marking pinned blocks does not count as an access.
+	if lru := p.quota.evictionCandidates()[0]; !lru.Equals(blks[0].Cid()) {
+		t.Errorf("expected the pinned block to remain the least recently used, got %s", lru)
+	}
+}
+
+// blockingBlockstore fails the first Put after it is unblocked.
+type blockingBlockstore struct {
+	blockstore.Blockstore
+	entered chan struct{}
+	unblock chan struct{}
+	calls   atomic.Int32
+}
+
+func (bs *blockingBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	if bs.calls.Add(1) == 1 {
+		close(bs.entered)
+		<-bs.unblock
+		return errors.New("write failed")
+	}
+	return bs.Blockstore.Put(ctx, blk)
+}
+
+func TestQuotaConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	bs := &blockingBlockstore{
+		Blockstore: blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())),
+		entered:    make(chan struct{}),
+		unblock:    make(chan struct{}),
+	}
+	qbs, err := newQuotaBlockstore(ctx, bs, 1000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk := newRawBlock(t, make([]byte, 100))
+	errCh := make(chan error)
+	go func() {
+		errCh <- qbs.Put(ctx, blk)
+	}()
+	<-bs.entered
+
+	// A second write of the same block, while the first one is ongoing,
+	// must actually store it.
+	err = qbs.Put(ctx, blk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(bs.unblock)
+	if err := <-errCh; err == nil {
+		t.Fatal("expected the first write to fail")
+	}
+
+	if ok, _ := qbs.Has(ctx, blk.Cid()); !ok {
+		t.Error("block should be stored")
+	}
+	if used := qbs.usage(); used != 100 {
+		t.Errorf("expected 100 bytes used, got %d", used)
+	}
+}
+
+func TestQuotaEvictionOverPinned(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	qbs, err := newQuotaBlockstore(ctx, bs, 1000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signaled := func() bool {
+		select {
+		case <-qbs.evictCh:
+			return true
+		default:
+			return false
+		}
+	}
+
+	for i := 0; i < 12; i++ {
+		data := make([]byte, 100)
+		data[0] = byte(i)
+		err = qbs.Put(ctx, newRawBlock(t, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !signaled() {
+		t.Fatal("expected an eviction signal")
+	}
+
+	// An eviction run could not get below the quota.
+	qbs.setPinnedFloor()
+	err = qbs.Put(ctx, newRawBlock(t, make([]byte, 50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signaled() {
+		t.Error("eviction should wait for more content to be written")
+	}
+	err = qbs.Put(ctx, newRawBlock(t, make([]byte, 60)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signaled() {
+		t.Error("expected an eviction signal after writing enough content")
+	}
+
+	qbs.setPinnedFloor()
+	qbs.pinsRemoved()
+	if !signaled() {
+		t.Error("expected an eviction signal after removing pins")
+	}
+}
+
+func TestQuotaRefuseWrites(t *testing.T) {
+	ctx := context.Background()
+	p := setupQuotaPeer(t, &Config{MaxBlockstoreSize: 150, RefuseWritesOverQuota: true})
+
+	blk1 := newRawBlock(t, make([]byte, 100))
+	err := p.BlockStore().Put(ctx, blk1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writing the same block again does not count.
+	err = p.BlockStore().Put(ctx, blk1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk2 := newRawBlock(t, []byte("something else that does not fit in the quota................."))
+	err = p.BlockStore().Put(ctx, blk2)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatal("expected ErrQuotaExceeded, got", err)
+	}
+
+	err = p.BlockStore().DeleteBlock(ctx, blk1.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.BlockStore().Put(ctx, blk2)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
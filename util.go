@@ -10,11 +10,14 @@ import (
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	dualdht "github.com/libp2p/go-libp2p-kad-dht/dual"
 	record "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/config"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/pnet"
 	"github.com/libp2p/go-libp2p/core/routing"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
 	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
@@ -34,18 +37,113 @@ func NewInMemoryDatastore() datastore.Batching {
 	return dssync.MutexWrap(datastore.NewMapDatastore())
 }
 
-var connMgr, _ = connmgr.NewConnManager(100, 600, connmgr.WithGracePeriod(time.Minute))
+var (
+	defaultConnMgrLowWater  = 100
+	defaultConnMgrHighWater = 600
+	defaultConnMgrGrace     = time.Minute
+)
 
 // Libp2pOptionsExtra provides some useful libp2p options
 // to create a fully featured libp2p host. It can be used with
 // SetupLibp2p.
 var Libp2pOptionsExtra = []libp2p.Option{
 	libp2p.NATPortMap(),
-	libp2p.ConnectionManager(connMgr),
 	// libp2p.EnableAutoRelay(),
 	libp2p.EnableNATService(),
 }
 
+// ResourceLimits sets limits for the libp2p resource manager created with
+// NewResourceManager. Zero values use the libp2p defaults, scaled to the
+// given MaxMemory and MaxFileDescriptors.
+type ResourceLimits struct {
+	// MaxMemory is the memory, in bytes, that libp2p may reserve.
+	MaxMemory int64
+	// MaxFileDescriptors is the number of file descriptors that libp2p
+	// may use.
+	MaxFileDescriptors int
+	// MaxConnections is the total number of open connections. It
+	// should be above the high water mark of the connection manager
+	// (600 by default).
+	MaxConnections int
+	// MaxStreams is the total number of open streams.
+	MaxStreams int
+	// MaxConnectionsPerPeer is the number of connections with any peer.
+	MaxConnectionsPerPeer int
+	// MaxStreamsPerPeer is the number of streams with any peer.
+	MaxStreamsPerPeer int
+	// MaxStreamsPerProtocol is the number of streams for any protocol.
+	MaxStreamsPerProtocol int
+}
+
+// DefaultResourceLimits returns the limits used by SetupLibp2p when no
+// resource manager is given. They are meant for hosts embedded in
+// applications, rather than for dedicated IPFS nodes.
+func DefaultResourceLimits() ResourceLimits {
+	return ResourceLimits{
+		MaxMemory:          256 << 20, // 256MiB
+		MaxFileDescriptors: 1024,
+		MaxConnections:     1000,
+	}
+}
+
+// NewResourceManager returns a libp2p resource manager with the given
+// limits, which can be passed to SetupLibp2p with the
+// libp2p.ResourceManager() option.
+func NewResourceManager(limits ResourceLimits) (network.ResourceManager, error) {
+	scaling := rcmgr.DefaultLimits
+	libp2p.SetDefaultServiceLimits(&scaling)
+	scaled := scaling.AutoScale()
+	if limits.MaxMemory > 0 || limits.MaxFileDescriptors > 0 {
+		defaults := DefaultResourceLimits()
+		if limits.MaxMemory <= 0 {
+			limits.MaxMemory = defaults.MaxMemory
+		}
+		if limits.MaxFileDescriptors <= 0 {
+			limits.MaxFileDescriptors = defaults.MaxFileDescriptors
+		}
+		scaled = scaling.Scale(limits.MaxMemory, limits.MaxFileDescriptors)
+	}
+
+	partial := rcmgr.PartialLimitConfig{
+		System: rcmgr.ResourceLimits{
+			Conns:   rcmgr.LimitVal(limits.MaxConnections),
+			Streams: rcmgr.LimitVal(limits.MaxStreams),
+		},
+		PeerDefault: rcmgr.ResourceLimits{
+			Conns:   rcmgr.LimitVal(limits.MaxConnectionsPerPeer),
+			Streams: rcmgr.LimitVal(limits.MaxStreamsPerPeer),
+		},
+		ProtocolDefault: rcmgr.ResourceLimits{
+			Streams: rcmgr.LimitVal(limits.MaxStreamsPerProtocol),
+		},
+	}
+	return rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(partial.Build(scaled)))
+}
+
+// hostDefaults sets a connection manager and a resource manager on hosts
+// which were not given any, so that they are not shared between hosts.
+func hostDefaults(cfg *config.Config) error {
+	if cfg.ConnManager == nil {
+		cm, err := connmgr.NewConnManager(
+			defaultConnMgrLowWater,
+			defaultConnMgrHighWater,
+			connmgr.WithGracePeriod(defaultConnMgrGrace),
+		)
+		if err != nil {
+			return err
+		}
+		cfg.ConnManager = cm
+	}
+	if cfg.ResourceManager == nil {
+		rm, err := NewResourceManager(DefaultResourceLimits())
+		if err != nil {
+			return err
+		}
+		cfg.ResourceManager = rm
+	}
+	return nil
+}
+
 // SetupLibp2p returns a routed host and DHT instances that can be used to
 // easily create a ipfslite Peer. You may consider to use Peer.Bootstrap()
 // after creating the IPFS-Lite Peer to connect to other peers. When the
@@ -53,12 +151,23 @@ var Libp2pOptionsExtra = []libp2p.Option{
 // provider records are lost on program shutdown.
 //
 // Additional libp2p options can be passed. Note that the Identity,
-// ListenAddrs and PrivateNetwork options will be setup automatically.
+// ListenAddrs and PrivateNetwork options will be setup automatically. Unless
+// given with the ConnectionManager() and ResourceManager() options, every host
+// gets its own connection manager (100 to 600 connections) and a resource
+// manager with DefaultResourceLimits (see NewResourceManager).
 // Interesting options to pass: NATPortMap() EnableAutoRelay*(),
 // libp2p.EnableNATService(), DisableRelay(), ConnectionManager(...)... see
 // https://godoc.org/github.com/libp2p/go-libp2p#Option for more info.
 //
-// The secret should be a 32-byte pre-shared-key byte slice.
+// The secret should be a 32-byte pre-shared-key byte slice. When set, only
+// the TCP and WebSocket transports are enabled, as QUIC and WebTransport do
+// not support pre-shared keys. Alternatively, pass a nil secret and the
+// libp2p.ConnectionGater(NewAllowlistGater(...)) option to keep every
+// transport while only connecting to known peers. More generally, a
+// ConnectionGater can restrict which peers and addresses the host talks to.
+//
+// See LoadOrCreateIdentity for a way to keep a stable hostKey across
+// restarts.
 func SetupLibp2p(
 	hostKey crypto.PrivKey,
 	secret pnet.PSK,
@@ -89,6 +198,7 @@ func SetupLibp2p(
 		}),
 	}
 	finalOpts = append(finalOpts, opts...)
+	finalOpts = append(finalOpts, hostDefaults)
 
 	h, err := libp2p.New(
 		finalOpts...,
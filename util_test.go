@@ -0,0 +1,45 @@
+package ipfslite
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+func TestSetupLibp2pPerHostManagers(t *testing.T) {
+	h1 := setupQUICHost(t, Libp2pOptionsExtra...)
+	h2 := setupQUICHost(t, Libp2pOptionsExtra...)
+	if h1.ConnManager() == h2.ConnManager() {
+		t.Error("hosts should not share the connection manager")
+	}
+	if h1.Network().ResourceManager() == h2.Network().ResourceManager() {
+		t.Error("hosts should not share the resource manager")
+	}
+	checkConnLimit(t, h1.Network().ResourceManager(), DefaultResourceLimits().MaxConnections)
+
+	rm, err := NewResourceManager(ResourceLimits{MaxConnections: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3 := setupQUICHost(t, libp2p.ResourceManager(rm))
+	if h3.Network().ResourceManager() != rm {
+		t.Error("the given resource manager should be used")
+	}
+	checkConnLimit(t, rm, 42)
+}
+
+func checkConnLimit(t *testing.T, rm network.ResourceManager, expected int) {
+	t.Helper()
+	err := rm.ViewSystem(func(scope network.ResourceScope) error {
+		limit := scope.(rcmgr.ResourceScopeLimiter).Limit()
+		if n := limit.GetConnTotalLimit(); n != expected {
+			t.Errorf("expected a limit of %d connections, got %d", expected, n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}